@@ -14,6 +14,7 @@ import (
 type InitialData struct {
 	InitialPoint [3]float64 `json:"initialPoint"`
 	Boundry      float64    `json:"boundry"`
+	Norm         string     `json:"norm"` // "l2" (default), "linf" or "l1", the prover checks the same norm
 }
 
 // Function to calculate Euclidean distance between two 4D points
@@ -25,6 +26,37 @@ func euclideanDistance(p1, p2 [3]float64) float64 {
 	return math.Sqrt(sum)
 }
 
+// Function to calculate the L-infinity distance, the largest difference of any coordinate
+func chebyshevDistance(p1, p2 [3]float64) float64 {
+	max := 0.0
+	for i := 0; i < 3; i++ {
+		max = math.Max(max, math.Abs(p1[i]-p2[i]))
+	}
+	return max
+}
+
+// Function to calculate the L1 distance, the sum of the coordinate differences
+func manhattanDistance(p1, p2 [3]float64) float64 {
+	sum := 0.0
+	for i := 0; i < 3; i++ {
+		sum += math.Abs(p1[i] - p2[i])
+	}
+	return sum
+}
+
+// Function to calculate the distance between two points in the given norm
+func pointDistance(norm string, p1, p2 [3]float64) (float64, error) {
+	switch norm {
+	case "", "l2":
+		return euclideanDistance(p1, p2), nil
+	case "linf":
+		return chebyshevDistance(p1, p2), nil
+	case "l1":
+		return manhattanDistance(p1, p2), nil
+	}
+	return 0, fmt.Errorf("unknown norm %q, expected l2, linf or l1", norm)
+}
+
 // Function to generate cryptographically secure random floating-point numbers
 func secureRandomFloat64(min, max float64) (float64, error) {
 	// Create a 64-bit random number
@@ -42,8 +74,10 @@ func secureRandomFloat64(min, max float64) (float64, error) {
 	return min + randomFloat*(max-min), nil
 }
 
-// Function to generate a random point within a max distance from the reference point
-func generatePointWithinDistance(referencePoint [3]float64, maxDistance float64) ([3]float64, error) {
+// Function to generate a random point within a max distance from the reference point.
+// Points are drawn from the box around the reference point and kept if they lie
+// inside the ball of the given norm, for L-infinity the box is the ball.
+func generatePointWithinDistance(referencePoint [3]float64, maxDistance float64, norm string) ([3]float64, error) {
 	var newPoint [3]float64
 	for {
 		// Generate random values by adding small perturbations to each component of the reference point
@@ -52,17 +86,19 @@ func generatePointWithinDistance(referencePoint [3]float64, maxDistance float64)
 			if err != nil {
 				return [3]float64{}, err
 			}
-			newPoint[i] = referencePoint[i] + perturbation
+			// Round to 2 decimal places before the distance check, the prover
+			// checks the rounded point against the ball
+			newPoint[i] = math.Round((referencePoint[i]+perturbation)*100) / 100
 		}
 
-		// Calculate the Euclidean distance between the new point and the reference point
-		distance := euclideanDistance(newPoint, referencePoint)
+		// Calculate the distance between the new point and the reference point
+		distance, err := pointDistance(norm, newPoint, referencePoint)
+		if err != nil {
+			return [3]float64{}, err
+		}
 
-		// If the distance is within the limit, round each component to 2 decimal places and return the point
+		// If the distance is within the limit, return the point
 		if distance <= maxDistance {
-			for i := 0; i < 3; i++ {
-				newPoint[i] = math.Round(newPoint[i]*100) / 100 // Round to 2 decimal places
-			}
 			break
 		}
 	}
@@ -93,7 +129,7 @@ func main() {
 	numPoints := 10
 	generatedPoints := make([][3]float64, numPoints)
 	for i := 0; i < numPoints; i++ {
-		point, err := generatePointWithinDistance(referencePoint, maxDistance)
+		point, err := generatePointWithinDistance(referencePoint, maxDistance, initialData.Norm)
 		if err != nil {
 			fmt.Println("Error generating point:", err)
 			return
@@ -0,0 +1,218 @@
+// Command Verify checks a proof of the neural-network prover without the
+// model: it reads the verifying key, the proof, the metadata written next to
+// them and the public inputs, and exits with a non-zero status if the proof
+// doesn't hold. With -bundle it reads only the verifying key and a proof
+// bundle, which carries the public witness itself. The key has to be the
+// verifier's own -vk, or have the -fingerprint the verifier pinned. -lipschitz checks a proof
+// of a model's Lipschitz bound instead. -backend plonk checks PLONK proofs,
+// refusing those whose keys were set up from an unsafe SRS generated for
+// testing unless -allow-unsafe-srs is given.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"sudokuChecker/bundle"
+	"sudokuChecker/nn"
+	"sudokuChecker/proofsystem"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+)
+
+const (
+	inputFile = "inputs.json"
+	metaFile  = "proof.meta.json"
+)
+
+// verifyBundle checks the bundle at bundlePath end to end against the key at
+// vkPath, read for the backend the bundle names. The key is the verifier's:
+// either vkPath is given, or the key found next to the bundle has to have
+// the pinned fingerprint. A bundle made with an unsafe setup is refused unless
+// allowUnsafe.
+func verifyBundle(vkPath, fingerprint, bundlePath string, allowUnsafe bool) (*bundle.Bundle, error) {
+	if vkPath == "" && fingerprint == "" {
+		return nil, fmt.Errorf("a bundle can't vouch for its own key, give the trusted -vk or pin its -fingerprint")
+	}
+	b, err := bundle.Load(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := proofsystem.CheckSetup(b.Setup, allowUnsafe); err != nil {
+		return nil, err
+	}
+	backend, err := b.ProofSystem()
+	if err != nil {
+		return nil, err
+	}
+	if vkPath == "" {
+		vkPath = backend.Files().VK
+	}
+	vk := backend.NewVerifyingKey()
+	if err := proofsystem.ReadFrom(vkPath, vk); err != nil {
+		return nil, err
+	}
+	if fingerprint != "" {
+		if err := bundle.CheckPinned(vk, fingerprint); err != nil {
+			return nil, err
+		}
+	}
+	return b, b.Verify(vk)
+}
+
+// verify checks the proof at proofPath against the key at vkPath, with the
+// public witness rebuilt from the metadata and the inputs. The witness holds
+// the circuit tag of the metadata's shape and quantization, so they have to be
+// the key's. A proof made with an unsafe setup is refused unless allowUnsafe.
+func verify(backend proofsystem.Backend, vkPath, proofPath, metaPath, inputsPath string, allowUnsafe bool) (*nn.ProofMetadata, error) {
+	meta, err := nn.LoadMetadata(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := proofsystem.CheckSetup(meta.Setup, allowUnsafe); err != nil {
+		return nil, err
+	}
+	inputs, err := nn.LoadInputs(inputsPath)
+	if err != nil {
+		return nil, err
+	}
+	assignment, err := nn.PublicAssignment(meta, inputs)
+	if err != nil {
+		return nil, err
+	}
+	return meta, check(backend, vkPath, proofPath, assignment)
+}
+
+// verifyLipschitz checks the Lipschitz proof at proofPath against the key at
+// vkPath, with the public witness rebuilt from the metadata, refusing an
+// unsafe setup unless allowUnsafe
+func verifyLipschitz(backend proofsystem.Backend, vkPath, proofPath, metaPath string, allowUnsafe bool) (*nn.LipschitzMetadata, error) {
+	meta, err := nn.LoadLipschitzMetadata(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := proofsystem.CheckSetup(meta.Setup, allowUnsafe); err != nil {
+		return nil, err
+	}
+	assignment, err := nn.LipschitzPublicAssignment(meta)
+	if err != nil {
+		return nil, err
+	}
+	return meta, check(backend, vkPath, proofPath, assignment)
+}
+
+// check checks the proof at proofPath against the key at vkPath and the
+// public part of assignment
+func check(backend proofsystem.Backend, vkPath, proofPath string, assignment frontend.Circuit) error {
+	publicWitness, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		return err
+	}
+	vk := backend.NewVerifyingKey()
+	if err := proofsystem.ReadFrom(vkPath, vk); err != nil {
+		return err
+	}
+	proof := backend.NewProof()
+	if err := proofsystem.ReadFrom(proofPath, proof); err != nil {
+		return err
+	}
+	return backend.Verify(proof, vk, publicWitness)
+}
+
+func main() {
+	backendName := flag.String("backend", "groth16", "proof system the proof was made with, groth16 or plonk")
+	vkPath := flag.String("vk", "", "verifying key of the circuit, vk.g16vk or vk.plonkvk by default")
+	proofPath := flag.String("proof", "", "proof to check, proof.g16p or proof.plonkp by default")
+	metaPath := flag.String("meta", "", "metadata the prover wrote next to the proof, "+metaFile+" by default")
+	inputsPath := flag.String("inputs", inputFile, "public inputs the proof is about")
+	lipschitz := flag.Bool("lipschitz", false, "check a Lipschitz proof, lipschitz.g16vk, lipschitz.g16p and "+nn.LipschitzMetaFile+" by default, instead of a proof about inputs")
+	bundlePath := flag.String("bundle", "", "proof bundle to check instead of -proof, -meta and -inputs, it names its backend")
+	fingerprint := flag.String("fingerprint", "", "fingerprint the verifying key of a -bundle has to have, when -vk isn't a key you trust")
+	allowUnsafe := flag.Bool("allow-unsafe-srs", false, "accept PLONK proofs whose keys were set up from an unsafe SRS generated for testing")
+	flag.Parse()
+
+	if *bundlePath != "" {
+		b, err := verifyBundle(*vkPath, *fingerprint, *bundlePath, *allowUnsafe)
+		if err != nil {
+			fmt.Println("Verification failed:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Verification succeeded for the", b.Kind, "circuit", b.Circuit, "proven", b.Created.Format(time.RFC3339))
+		if b.Kind == "lipschitz" {
+			publicWitness, err := b.Witness()
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			commitment, bound, err := nn.LipschitzClaim(publicWitness)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Println("The model with commitment", commitment, "has a Lipschitz bound of at most", bound)
+		}
+		return
+	}
+
+	backend, err := proofsystem.New(*backendName, "")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	vkFile, proofFile, metaDefault := backend.Files().VK, backend.Files().Proof, metaFile
+	if *lipschitz {
+		vkFile, proofFile = nn.LipschitzFiles(backend)
+		metaDefault = nn.LipschitzMetaFile
+	}
+	for _, f := range []struct {
+		dst *string
+		def string
+	}{{vkPath, vkFile}, {proofPath, proofFile}, {metaPath, metaDefault}} {
+		if *f.dst == "" {
+			*f.dst = f.def
+		}
+	}
+
+	if *lipschitz {
+		meta, err := verifyLipschitz(backend, *vkPath, *proofPath, *metaPath, *allowUnsafe)
+		if err != nil {
+			fmt.Println("Verification failed:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Verification succeeded: the model with commitment", meta.Commitment, "has a Lipschitz bound of at most", meta.Bound)
+		return
+	}
+	meta, err := verify(backend, *vkPath, *proofPath, *metaPath, *inputsPath, *allowUnsafe)
+	if err != nil {
+		fmt.Println("Verification failed:", err)
+		os.Exit(1)
+	}
+	report(os.Stdout, meta)
+}
+
+// report prints what a verified proof established. Every line comes from a
+// statement of the shape, whose values went into the public witness the proof
+// was checked against; the classes of the inputs stay private.
+func report(w io.Writer, meta *nn.ProofMetadata) {
+	s := meta.Shape
+	fmt.Fprintln(w, "Verification succeeded for the model with commitment", meta.Commitment, "on", s.BatchSize, "inputs")
+	if s.Ball != "" {
+		fmt.Fprintln(w, "Every input is within", meta.Ball.Radius, "of the ball center in the", s.Ball, "norm")
+	}
+	if s.SameLabel {
+		fmt.Fprintln(w, "Every input and the ball center are classified as", *meta.Label)
+	}
+	if s.Certify {
+		fmt.Fprintln(w, "Every point within", meta.Certify.Epsilon, "of the certified center is classified as", meta.Certify.Label)
+	}
+	if s.Margin {
+		fmt.Fprintln(w, "Every input wins by at least", *meta.Margin)
+	}
+	if s.ReportMargin {
+		fmt.Fprintln(w, "The smallest margin is", *meta.SmallestMargin)
+	}
+}
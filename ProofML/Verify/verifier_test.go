@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sudokuChecker/bundle"
+	"sudokuChecker/fixedpoint"
+	"sudokuChecker/nn"
+	"sudokuChecker/proofsystem"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+)
+
+func TestVerify(t *testing.T) {
+	assert := test.NewAssert(t)
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	// prove weightsGood.json on one point, as the prover does
+	var m nn.ModelData
+	assert.NoError(json.Unmarshal([]byte(`{
+		"weights": [
+			[[0.1, 0.75, 0.06], [0.77, -0.03, 0.32], [-0.91, 0.91, -0.03]],
+			[[0.1, -0.66, -0.69], [-0.97, 0.49, -0.38], [0.01, 0.21, -0.53]]
+		],
+		"biases": [[-0.13, 0.21, 0.83], [0.34, -0.28, 0.69]]
+	}`), &m))
+	inputs := &nn.InputData{Inputs: [][]fixedpoint.Decimal{{
+		fixedpoint.MustDecimal("-0.22"), fixedpoint.MustDecimal("0.03"), fixedpoint.MustDecimal("0.18"),
+	}}}
+	data := &nn.ProverData{Model: &m, Inputs: inputs, Expected: &nn.ExpectedData{Expected: []int{2}}}
+	shape, err := nn.CircuitShape(data)
+	assert.NoError(err)
+	assignment, err := nn.NewAssignment(shape, data)
+	assert.NoError(err)
+	cs, pk, vk, err := nn.KeyStore{Dir: path("keys")}.Setup(nn.CircuitID("model", "groth16", shape, m.Quant()), nn.NewProveModelCircuit(shape, m.Quant()))
+	assert.NoError(err)
+	witness, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
+	assert.NoError(err)
+	backend := proofsystem.Groth16{}
+	proof, err := backend.Prove(cs, pk, witness)
+	assert.NoError(err)
+
+	write := func(name string, v io.WriterTo) {
+		f, err := os.Create(path(name))
+		assert.NoError(err)
+		defer f.Close()
+		_, err = v.WriteTo(f)
+		assert.NoError(err)
+	}
+	vkFile, proofFile := backend.Files().VK, backend.Files().Proof
+	write(vkFile, vk)
+	write(proofFile, proof)
+	assert.NoError(nn.WriteJSON(path(metaFile), nn.ProofMetadata{Shape: shape, Quantization: m.Quant(), Commitment: fmt.Sprint(assignment.Commitment)}))
+	assert.NoError(nn.WriteJSON(path(inputFile), inputs))
+
+	meta, err := verify(backend, path(vkFile), path(proofFile), path(metaFile), path(inputFile), false)
+	assert.NoError(err)
+	assert.Equal(fmt.Sprint(assignment.Commitment), meta.Commitment)
+	var out bytes.Buffer
+	report(&out, meta)
+	assert.Equal(fmt.Sprintf("Verification succeeded for the model with commitment %s on 1 inputs\n", meta.Commitment), out.String())
+
+	// a claim the proof doesn't make is refused, not reported
+	meta.Certify = &nn.CertifyData{Center: inputs.Inputs[0], Epsilon: fixedpoint.MustDecimal("0.5"), Label: 2}
+	assert.NoError(nn.WriteJSON(path("claims.json"), meta))
+	_, err = verify(backend, path(vkFile), path(proofFile), path("claims.json"), path(inputFile), false)
+	assert.ErrorContains(err, "the metadata has a certified box but the proof doesn't use one")
+
+	// nor is a proof recorded as made with an unsafe setup, unless allowed
+	meta.Certify = nil
+	meta.Setup = proofsystem.UnsafeSetup
+	assert.NoError(nn.WriteJSON(path("unsafe.json"), meta))
+	_, err = verify(backend, path(vkFile), path(proofFile), path("unsafe.json"), path(inputFile), false)
+	assert.ErrorContains(err, "unsafe SRS")
+	_, err = verify(backend, path(vkFile), path(proofFile), path("unsafe.json"), path(inputFile), true)
+	assert.NoError(err)
+
+	// the bundle needs nothing but the key
+	publicWitness, err := witness.Public()
+	assert.NoError(err)
+	b, err := bundle.New(bundle.Model("model", backend, shape, m.Quant()), vk, publicWitness, proof)
+	assert.NoError(err)
+	assert.NoError(b.Write(path("proof.bundle.json")))
+	b, err = verifyBundle(path(vkFile), "", path("proof.bundle.json"), false)
+	assert.NoError(err)
+	assert.Equal("model", b.Kind)
+
+	// but that key has to be the verifier's, a prover could ship its own key
+	// with a bundle whose fingerprint matches it
+	_, forgedVK, err := backend.Setup(cs)
+	assert.NoError(err)
+	write("forged.g16vk", forgedVK)
+	pinned, err := bundle.Fingerprint(vk)
+	assert.NoError(err)
+	_, err = verifyBundle(path("forged.g16vk"), pinned, path("proof.bundle.json"), false)
+	assert.ErrorContains(err, "is not the pinned key")
+	_, err = verifyBundle(path(vkFile), pinned, path("proof.bundle.json"), false)
+	assert.NoError(err)
+	_, err = verifyBundle("", "", path("proof.bundle.json"), false)
+	assert.ErrorContains(err, "can't vouch for its own key")
+
+	// nor can the metadata rescale the inputs: with ten times the input
+	// scale, inputs ten times smaller quantize to the same public values,
+	// but the circuit tag no longer matches the key's
+	rescaled := m.Quant()
+	rescaled.InputScale *= 10
+	assert.NoError(nn.WriteJSON(path("rescaled.json"), nn.ProofMetadata{Shape: shape, Quantization: rescaled, Commitment: fmt.Sprint(assignment.Commitment)}))
+	assert.NoError(nn.WriteJSON(path("smaller.json"), &nn.InputData{Inputs: [][]fixedpoint.Decimal{{
+		fixedpoint.MustDecimal("-0.022"), fixedpoint.MustDecimal("0.003"), fixedpoint.MustDecimal("0.018"),
+	}}}))
+	_, err = verify(backend, path(vkFile), path(proofFile), path("rescaled.json"), path("smaller.json"), false)
+	assert.Error(err)
+
+	// the proof says nothing about other inputs or another model
+	inputs.Inputs[0][1] = fixedpoint.MustDecimal("0.04")
+	assert.NoError(nn.WriteJSON(path("other.json"), inputs))
+	_, err = verify(backend, path(vkFile), path(proofFile), path(metaFile), path("other.json"), false)
+	assert.Error(err)
+	assert.NoError(nn.WriteJSON(path(metaFile), nn.ProofMetadata{Shape: shape, Quantization: m.Quant(), Commitment: "1"}))
+	_, err = verify(backend, path(vkFile), path(proofFile), path(metaFile), path(inputFile), false)
+	assert.Error(err)
+}
+
+func TestVerifyLipschitz(t *testing.T) {
+	assert := test.NewAssert(t)
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	// the largest row sums of weightsGood.json are 1.85 and 1.84
+	var m nn.ModelData
+	assert.NoError(json.Unmarshal([]byte(`{
+		"weights": [
+			[[0.1, 0.75, 0.06], [0.77, -0.03, 0.32], [-0.91, 0.91, -0.03]],
+			[[0.1, -0.66, -0.69], [-0.97, 0.49, -0.38], [0.01, 0.21, -0.53]]
+		],
+		"biases": [[-0.13, 0.21, 0.83], [0.34, -0.28, 0.69]]
+	}`), &m))
+	backend := proofsystem.Groth16{}
+	p, err := nn.ProveLipschitz(nn.KeyStore{Dir: path("keys")}, &m, fixedpoint.MustDecimal("3.5"))
+	assert.NoError(err)
+	vkFile, proofFile := nn.LipschitzFiles(backend)
+	assert.NoError(proofsystem.WriteTo(path(vkFile), p.VK))
+	assert.NoError(proofsystem.WriteTo(path(proofFile), p.Proof))
+	assert.NoError(nn.WriteJSON(path(nn.LipschitzMetaFile), p.Meta))
+	b, err := bundle.New(bundle.Model("lipschitz", backend, p.Meta.Shape, p.Meta.Quantization), p.VK, p.PublicWitness, p.Proof)
+	assert.NoError(err)
+	assert.NoError(b.Write(path("lipschitz.bundle.json")))
+
+	meta, err := verifyLipschitz(backend, path(vkFile), path(proofFile), path(nn.LipschitzMetaFile), false)
+	assert.NoError(err)
+	assert.Equal("3.5", meta.Bound.String())
+
+	// the bundle's public witness holds the same claim
+	b, err = verifyBundle(path(vkFile), "", path("lipschitz.bundle.json"), false)
+	assert.NoError(err)
+	assert.Equal("lipschitz", b.Kind)
+	publicWitness, err := b.Witness()
+	assert.NoError(err)
+	commitment, bound, err := nn.LipschitzClaim(publicWitness)
+	assert.NoError(err)
+	assert.Equal(meta.Commitment, commitment)
+	assert.Equal("3.5", bound.String())
+
+	// the circuit doesn't read the activations, so a bundle claiming a steep
+	// one is refused even with the circuit id to match
+	steep := p.Meta.Shape
+	steep.Layers = []nn.Layer{{Type: nn.Dense, Activation: nn.GELU}, {Type: nn.Dense, Activation: nn.NoActivation}}
+	steep.Table = &nn.ActivationTable{Min: fixedpoint.MustDecimal("-3"), Max: fixedpoint.MustDecimal("3")}
+	forged, err := bundle.New(bundle.Model("lipschitz", backend, steep, p.Meta.Quantization), p.VK, p.PublicWitness, p.Proof)
+	assert.NoError(err)
+	assert.NoError(forged.Write(path("steep.bundle.json")))
+	_, err = verifyBundle(path(vkFile), "", path("steep.bundle.json"), false)
+	assert.ErrorContains(err, "gelu isn't 1-Lipschitz")
+
+	// the proof doesn't hold for a tighter bound
+	meta.Bound = fixedpoint.MustDecimal("3.4")
+	assert.NoError(nn.WriteJSON(path(nn.LipschitzMetaFile), meta))
+	_, err = verifyLipschitz(backend, path(vkFile), path(proofFile), path(nn.LipschitzMetaFile), false)
+	assert.Error(err)
+}
@@ -0,0 +1,256 @@
+// Package bundle is a self-describing proof format: one JSON file holding a
+// proof, its public witness and what the proof was made for, the circuit id
+// and shape, the curve, backend and setup, the quantization and a fingerprint
+// of the verifying key. A bare proof.g16p says none of this, so a verifier has
+// to know from elsewhere which key and which public inputs it belongs to.
+//
+// The fingerprint only names the key the prover used. Anyone can set up a
+// circuit and prove with their own key, so the key a bundle is verified
+// against has to come from the verifier, a copy it trusts or one whose
+// fingerprint it pinned, never from the prover alongside the bundle. The
+// circuit id and shape are only taken once they match the circuit tag in the
+// public witness, which the verifier's key holds the proof to.
+package bundle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"sudokuChecker/nn"
+	"sudokuChecker/proofsystem"
+	"sudokuChecker/sudoku"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/witness"
+)
+
+// Version of the bundle format
+const Version = 1
+
+// Bundle is a proof with everything needed to check it but the verifying key
+type Bundle struct {
+	Version       int             `json:"version"`
+	Circuit       string          `json:"circuit"`                // id of the circuit, as named in the key store
+	Kind          string          `json:"kind"`                   // model, lipschitz or sudoku
+	Shape         json.RawMessage `json:"shape,omitempty"`        // nn.ModelShape of the model and lipschitz circuits
+	Quantization  json.RawMessage `json:"quantization,omitempty"` // nn.QuantConfig of the model and lipschitz circuits
+	Curve         string          `json:"curve"`
+	Backend       string          `json:"backend"`         // groth16 or plonk
+	Setup         string          `json:"setup,omitempty"` // SetupID of the keys, see proofsystem.CheckSetup
+	VKFingerprint string          `json:"vkFingerprint"`   // Fingerprint of the verifying key
+	PublicWitness []byte          `json:"publicWitness"`   // gnark binary encoding, base64 in the JSON
+	Proof         []byte          `json:"proof"`
+	Created       time.Time       `json:"created"`
+}
+
+// Circuit describes the circuit a proof was made for
+type Circuit struct {
+	ID           string
+	Kind         string
+	Backend      proofsystem.Backend
+	Shape        *nn.ModelShape
+	Quantization *nn.QuantConfig
+}
+
+// Model describes a circuit of the nn package, kind is model or lipschitz
+func Model(kind string, backend proofsystem.Backend, shape nn.ModelShape, quant nn.QuantConfig) Circuit {
+	return Circuit{ID: nn.CircuitID(kind, backend.Name(), shape, quant), Kind: kind, Backend: backend, Shape: &shape, Quantization: &quant}
+}
+
+// Sudoku describes the Sudoku circuit
+func Sudoku(backend proofsystem.Backend) Circuit {
+	return Circuit{ID: sudoku.CircuitID, Kind: "sudoku", Backend: backend}
+}
+
+// New bundles proof with its public witness, made with the circuit c and the
+// key vk
+func New(c Circuit, vk proofsystem.VerifyingKey, publicWitness witness.Witness, proof proofsystem.Proof) (*Bundle, error) {
+	b := &Bundle{
+		Version: Version,
+		Circuit: c.ID,
+		Kind:    c.Kind,
+		Curve:   ecc.BN254.String(),
+		Backend: c.Backend.Name(),
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+	var err error
+	if b.Setup, err = c.Backend.SetupID(); err != nil {
+		return nil, err
+	}
+	if c.Shape != nil {
+		if b.Shape, err = json.Marshal(c.Shape); err != nil {
+			return nil, err
+		}
+	}
+	if c.Quantization != nil {
+		if b.Quantization, err = json.Marshal(c.Quantization); err != nil {
+			return nil, err
+		}
+	}
+	if b.VKFingerprint, err = Fingerprint(vk); err != nil {
+		return nil, err
+	}
+	if b.PublicWitness, err = publicWitness.MarshalBinary(); err != nil {
+		return nil, fmt.Errorf("encoding public witness: %w", err)
+	}
+	var proofBytes bytes.Buffer
+	if _, err := proof.WriteTo(&proofBytes); err != nil {
+		return nil, fmt.Errorf("encoding proof: %w", err)
+	}
+	b.Proof = proofBytes.Bytes()
+	return b, nil
+}
+
+// Fingerprint is the hex SHA-256 of the serialized verifying key
+func Fingerprint(vk proofsystem.VerifyingKey) (string, error) {
+	h := sha256.New()
+	if _, err := vk.WriteTo(h); err != nil {
+		return "", fmt.Errorf("encoding verifying key: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Load reads a bundle written by Write
+func Load(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &b, nil
+}
+
+// Write writes b to path as indented JSON
+func (b *Bundle) Write(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// checkCircuit checks that the circuit id is the one of the kind, shape and
+// quantization the bundle describes, that the public witness is one of that
+// circuit, and that a Lipschitz shape has only 1-Lipschitz activations. The
+// model circuits constrain their tag to the shape they were compiled for, so
+// once the proof holds against the verifier's key the id is that key's.
+func (b *Bundle) checkCircuit(publicWitness witness.Witness) error {
+	var want string
+	switch b.Kind {
+	case "model", "lipschitz":
+		var (
+			shape nn.ModelShape
+			quant nn.QuantConfig
+		)
+		if err := json.Unmarshal(b.Shape, &shape); err != nil {
+			return fmt.Errorf("reading shape: %w", err)
+		}
+		if err := json.Unmarshal(b.Quantization, &quant); err != nil {
+			return fmt.Errorf("reading quantization: %w", err)
+		}
+		want = nn.CircuitID(b.Kind, b.Backend, shape, quant)
+		// the Lipschitz circuit leaves the activations to the verifier
+		if b.Kind == "lipschitz" {
+			if err := shape.CheckOneLipschitz(quant); err != nil {
+				return err
+			}
+		}
+		tag, err := nn.WitnessTag(publicWitness)
+		if err != nil {
+			return err
+		}
+		if tag.Cmp(nn.CircuitTag(b.Kind, shape, quant)) != 0 {
+			return fmt.Errorf("the public witness is for another circuit than the %s circuit described", b.Kind)
+		}
+	case "sudoku":
+		want = sudoku.CircuitID
+		if _, err := sudoku.Puzzle(publicWitness); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown circuit kind %q", b.Kind)
+	}
+	if b.Circuit != want {
+		return fmt.Errorf("circuit id %s doesn't match the %s circuit described, %s", b.Circuit, b.Kind, want)
+	}
+	return nil
+}
+
+// ProofSystem is the backend the proof was made with, to read its verifying
+// key with
+func (b *Bundle) ProofSystem() (proofsystem.Backend, error) {
+	// verifying needs no SRS, it is in the key
+	return proofsystem.New(b.Backend, "")
+}
+
+// CheckPinned returns an error unless vk has the fingerprint the verifier
+// pinned, for a key read from a file it doesn't otherwise trust
+func CheckPinned(vk proofsystem.VerifyingKey, fingerprint string) error {
+	got, err := Fingerprint(vk)
+	if err != nil {
+		return err
+	}
+	if got != fingerprint {
+		return fmt.Errorf("verifying key %s is not the pinned key %s", got, fingerprint)
+	}
+	return nil
+}
+
+// Verify checks everything the bundle claims: the format, curve and backend,
+// the circuit id and the public witness against the shape, vk against the
+// fingerprint, and finally the proof against vk and the public witness. vk
+// has to be the verifier's, see the package comment.
+func (b *Bundle) Verify(vk proofsystem.VerifyingKey) error {
+	if b.Version != Version {
+		return fmt.Errorf("bundle version %d, expected %d", b.Version, Version)
+	}
+	if b.Curve != ecc.BN254.String() {
+		return fmt.Errorf("proof made on %s, only %s is supported", b.Curve, ecc.BN254)
+	}
+	backend, err := b.ProofSystem()
+	if err != nil {
+		return err
+	}
+	publicWitness, err := b.Witness()
+	if err != nil {
+		return err
+	}
+	if err := b.checkCircuit(publicWitness); err != nil {
+		return err
+	}
+	fingerprint, err := Fingerprint(vk)
+	if err != nil {
+		return err
+	}
+	if fingerprint != b.VKFingerprint {
+		return fmt.Errorf("verifying key %s is not the key %s the proof was made for", fingerprint, b.VKFingerprint)
+	}
+	proof := backend.NewProof()
+	if _, err := proof.ReadFrom(bytes.NewReader(b.Proof)); err != nil {
+		return fmt.Errorf("decoding proof: %w", err)
+	}
+	if err := backend.Verify(proof, vk, publicWitness); err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	return nil
+}
+
+// Witness decodes the public witness
+func (b *Bundle) Witness() (witness.Witness, error) {
+	w, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+	if err := w.UnmarshalBinary(b.PublicWitness); err != nil {
+		return nil, fmt.Errorf("decoding public witness: %w", err)
+	}
+	return w, nil
+}
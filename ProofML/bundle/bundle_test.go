@@ -0,0 +1,108 @@
+package bundle
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"sudokuChecker/fixedpoint"
+	"sudokuChecker/nn"
+	"sudokuChecker/proofsystem"
+	"sudokuChecker/sudoku"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/test"
+)
+
+func TestBundle(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	// prove weightsGood.json on one point
+	var m nn.ModelData
+	assert.NoError(json.Unmarshal([]byte(`{
+		"weights": [
+			[[0.1, 0.75, 0.06], [0.77, -0.03, 0.32], [-0.91, 0.91, -0.03]],
+			[[0.1, -0.66, -0.69], [-0.97, 0.49, -0.38], [0.01, 0.21, -0.53]]
+		],
+		"biases": [[-0.13, 0.21, 0.83], [0.34, -0.28, 0.69]]
+	}`), &m))
+	data := &nn.ProverData{
+		Model:    &m,
+		Inputs:   &nn.InputData{Inputs: [][]fixedpoint.Decimal{{fixedpoint.MustDecimal("-0.22"), fixedpoint.MustDecimal("0.03"), fixedpoint.MustDecimal("0.18")}}},
+		Expected: &nn.ExpectedData{Expected: []int{2}},
+	}
+	shape, err := nn.CircuitShape(data)
+	assert.NoError(err)
+	assignment, err := nn.NewAssignment(shape, data)
+	assert.NoError(err)
+	cs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, nn.NewProveModelCircuit(shape, m.Quant()))
+	assert.NoError(err)
+	pk, vk, err := groth16.Setup(cs)
+	assert.NoError(err)
+	witness, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
+	assert.NoError(err)
+	proof, err := groth16.Prove(cs, pk, witness)
+	assert.NoError(err)
+	publicWitness, err := witness.Public()
+	assert.NoError(err)
+
+	b, err := New(Model("model", proofsystem.Groth16{}, shape, m.Quant()), vk, publicWitness, proof)
+	assert.NoError(err)
+	path := filepath.Join(t.TempDir(), "proof.bundle.json")
+	assert.NoError(b.Write(path))
+	b, err = Load(path)
+	assert.NoError(err)
+	assert.Equal(nn.CircuitID("model", "groth16", shape, m.Quant()), b.Circuit)
+	assert.NoError(b.Verify(vk))
+
+	// every claim of the bundle is checked
+	reload := func() *Bundle {
+		b, err := Load(path)
+		assert.NoError(err)
+		return b
+	}
+	_, otherVK, err := groth16.Setup(cs)
+	assert.NoError(err)
+	assert.Error(reload().Verify(otherVK))
+
+	other := reload()
+	other.Shape = json.RawMessage(`{"inputSize": 4}`)
+	assert.Error(other.Verify(vk))
+	other = reload()
+	other.Kind = "lipschitz"
+	assert.Error(other.Verify(vk))
+
+	// a bundle agreeing with itself on another quantization, or on another
+	// kind of circuit, doesn't match the witness the key checks
+	other = reload()
+	rescaled := m.Quant()
+	rescaled.InputScale *= 10
+	forged, err := New(Model("model", proofsystem.Groth16{}, shape, rescaled), vk, publicWitness, proof)
+	assert.NoError(err)
+	other.Circuit, other.Quantization = forged.Circuit, forged.Quantization
+	assert.ErrorContains(other.Verify(vk), "the public witness is for another circuit")
+	other = reload()
+	other.Kind, other.Circuit, other.Shape, other.Quantization = "sudoku", sudoku.CircuitID, nil, nil
+	assert.ErrorContains(other.Verify(vk), "isn't a Sudoku puzzle")
+
+	other = reload()
+	other.Curve = ecc.BLS12_381.String()
+	assert.Error(other.Verify(vk))
+	other = reload()
+	other.Backend = "plonk"
+	assert.Error(other.Verify(vk))
+
+	// another public witness, the input 0.03 changed to 0.04
+	other = reload()
+	data.Inputs.Inputs[0][1] = fixedpoint.MustDecimal("0.04")
+	changed, err := nn.NewAssignment(shape, data)
+	assert.NoError(err)
+	changedWitness, err := frontend.NewWitness(changed, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	assert.NoError(err)
+	other.PublicWitness, err = changedWitness.MarshalBinary()
+	assert.NoError(err)
+	assert.Error(other.Verify(vk))
+}
@@ -0,0 +1,232 @@
+package fixedpoint
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/consensys/gnark/constraint/solver"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/rangecheck"
+)
+
+func init() {
+	solver.RegisterHint(GetHints()...)
+}
+
+// GetHints returns the hints used by this package
+func GetHints() []solver.Hint {
+	return []solver.Hint{smallModHint, topBitHint}
+}
+
+// Fixed is a fixed-point number inside a circuit
+type Fixed struct {
+	V     frontend.Variable // scaled integer, negatives are p-|x|
+	Scale int64             // number of steps per unit
+}
+
+// New wraps a circuit variable holding v*scale
+func New(v frontend.Variable, scale int64) Fixed {
+	return Fixed{V: v, Scale: scale}
+}
+
+// API performs fixed-point operations on top of a frontend.API. Every range
+// check it makes, in comparisons and in SmallMod, goes to the circuit's one
+// shared gnark range checker. With the R1CS and PLONK builders that checker
+// splits all checked values into small limbs and proves them against a
+// single table with a log-derivative argument, which costs a few constraints
+// per value instead of one per bit.
+type API struct {
+	api frontend.API
+	rc  frontend.Rangechecker
+}
+
+// NewAPI returns the fixed-point operations for api
+func NewAPI(api frontend.API) *API {
+	return &API{api: api, rc: rangecheck.New(api)}
+}
+
+// Add returns a+b, both values must have the same scale
+func (f *API) Add(a, b Fixed) Fixed {
+	mustMatch(a.Scale, b.Scale)
+	return Fixed{V: f.api.Add(a.V, b.V), Scale: a.Scale}
+}
+
+// Sub returns a-b, both values must have the same scale
+func (f *API) Sub(a, b Fixed) Fixed {
+	mustMatch(a.Scale, b.Scale)
+	return Fixed{V: f.api.Sub(a.V, b.V), Scale: a.Scale}
+}
+
+// Mul returns a*b, the result has the product of both scales
+func (f *API) Mul(a, b Fixed) Fixed {
+	return Fixed{V: f.api.Mul(a.V, b.V), Scale: a.Scale * b.Scale}
+}
+
+// Rescale converts a to the smaller scale. The dropped digits are rounded
+// according to mode, exactly like Value.Rescale does on the host.
+func (f *API) Rescale(a Fixed, scale int64, mode Rounding) Fixed {
+	r := rescaleFactor(a.Scale, scale)
+	switch mode {
+	case Truncate:
+		// the floor quotient is one too small for negative values with a remainder
+		quo, rem := SmallMod(f.api, a.V, r)
+		isNeg := f.signBit(quo, ValueBits(f.api))
+		hasRem := f.api.Sub(1, f.api.IsZero(rem))
+		return Fixed{V: f.api.Add(quo, f.api.And(isNeg, hasRem)), Scale: scale}
+	case Ceil:
+		// ceil(a/r) == -floor(-a/r)
+		quo, _ := SmallMod(f.api, f.api.Neg(a.V), r)
+		return Fixed{V: f.api.Neg(quo), Scale: scale}
+	case HalfUp:
+		// floor(a/r + 1/2) == floor((2a + r) / 2r)
+		quo, _ := SmallMod(f.api, f.api.Add(f.api.Mul(a.V, 2), r), 2*r)
+		return Fixed{V: quo, Scale: scale}
+	default:
+		quo, _ := SmallMod(f.api, a.V, r)
+		return Fixed{V: quo, Scale: scale}
+	}
+}
+
+// Select returns a if cond is 1 and b otherwise
+func (f *API) Select(cond frontend.Variable, a, b Fixed) Fixed {
+	mustMatch(a.Scale, b.Scale)
+	return Fixed{V: f.api.Select(cond, a.V, b.V), Scale: a.Scale}
+}
+
+// IsNegative returns 1 if a < 0 and 0 otherwise. It also constrains a to
+// ValueBits signed bits, so out of range values make the proof fail.
+func (f *API) IsNegative(a Fixed) frontend.Variable {
+	return f.signBit(a.V, ValueBits(f.api))
+}
+
+// IsLess returns 1 if a < b and 0 otherwise
+func (f *API) IsLess(a, b Fixed) frontend.Variable {
+	mustMatch(a.Scale, b.Scale)
+	// a-b of two ValueBits numbers needs one more bit
+	return f.signBit(f.api.Sub(a.V, b.V), ValueBits(f.api)+1)
+}
+
+// AssertSignedBits constrains a to [-2^(nbBits-1), 2^(nbBits-1))
+func (f *API) AssertSignedBits(a Fixed, nbBits int) {
+	half := new(big.Int).Lsh(big.NewInt(1), uint(nbBits-1))
+	f.rc.Check(f.api.Add(a.V, half), nbBits)
+}
+
+// Cmp returns -1, 0 or 1 depending on whether a is less than, equal to or greater than b
+func (f *API) Cmp(a, b Fixed) frontend.Variable {
+	return f.api.Sub(f.IsLess(b, a), f.IsLess(a, b))
+}
+
+// signBit returns 1 if the signed nbBits number v is negative. Shifting v by
+// 2^(nbBits-1) maps [-2^(nbBits-1), 2^(nbBits-1)) onto [0, 2^nbBits), where
+// the top bit is set exactly for the non-negative values.
+//
+// The top bit t comes from a hint. Range checking the shifted value minus
+// t*2^(nbBits-1) to nbBits-1 bits proves both that the shifted value fits in
+// nbBits bits and that t is its top bit.
+func (f *API) signBit(v frontend.Variable, nbBits int) frontend.Variable {
+	half := new(big.Int).Lsh(big.NewInt(1), uint(nbBits-1))
+	shifted := f.api.Add(v, half)
+	res, err := f.api.Compiler().NewHint(topBitHint, 1, shifted, nbBits-1)
+	if err != nil {
+		panic(err)
+	}
+	top := res[0]
+	f.api.AssertIsBoolean(top)
+	f.rc.Check(f.api.Sub(shifted, f.api.Mul(top, half)), nbBits-1)
+	return f.api.Sub(1, top)
+}
+
+func topBitHint(_ *big.Int, inputs []*big.Int, outputs []*big.Int) error {
+	// inputs[0] = v -- value to split
+	// inputs[1] = k -- position of the bit
+	// outputs[0] = bit k of v
+	if len(inputs) != 2 || len(outputs) != 1 {
+		return errors.New("expected 2 inputs and 1 output")
+	}
+	outputs[0].SetUint64(uint64(inputs[0].Bit(int(inputs[1].Int64()))))
+	return nil
+}
+
+// ValueBits is the signed bit width allowed for fixed-point values and
+// SmallMod quotients. It assumes the values are small relative to the native
+// field, so that 2^ValueBits times a scale is still much smaller than the modulus.
+func ValueBits(api frontend.API) int {
+	return FieldValueBits(api.Compiler().FieldBitLen())
+}
+
+// FieldValueBits is ValueBits for a field of fieldBits bits, for use outside a circuit
+func FieldValueBits(fieldBits int) int {
+	return fieldBits/2 - 2
+}
+
+func smallModHint(mod *big.Int, inputs []*big.Int, outputs []*big.Int) error {
+	// computes the floor division of a signed field element
+	// inputs[0] = a -- input, values above p/2 stand for the negative a-p
+	// inputs[1] = r -- positive modulus
+	// outputs[0] = b -- remainder, always in [0, r)
+	// outputs[1] = (a-b)/r -- quotient, negative quotients are returned as p-q
+	if len(outputs) != 2 {
+		return errors.New("expected 2 outputs")
+	}
+	if len(inputs) != 2 {
+		return errors.New("expected 2 inputs")
+	}
+	if inputs[1].Sign() <= 0 {
+		return errors.New("modulus must be positive")
+	}
+	a := new(big.Int).Set(inputs[0])
+	if a.Cmp(new(big.Int).Rsh(mod, 1)) > 0 {
+		a.Sub(a, mod)
+	}
+	// DivMod is Euclidean division, which for a positive modulus rounds towards -inf
+	outputs[1].DivMod(a, inputs[1], outputs[0])
+	outputs[1].Mod(outputs[1], mod)
+	return nil
+}
+
+// SmallMod divides the signed value a by the constant r, rounding towards
+// negative infinity, and returns the quotient and the remainder in [0, r).
+//
+// The hint outputs are fully constrained: rem is checked to be below r, quo is
+// checked to fit in ValueBits bits as a signed number, and a == quo*r + rem.
+// Because |quo*r + rem| stays far below p, the equation cannot wrap around
+// the field and only the honest quotient and remainder satisfy it.
+func SmallMod(api frontend.API, a frontend.Variable, r int64) (quo, rem frontend.Variable) {
+	if r <= 0 {
+		panic("SmallMod: modulus must be positive")
+	}
+
+	res, err := api.Compiler().NewHint(smallModHint, 2, a, r)
+	if err != nil {
+		panic(err)
+	}
+	rem = res[0]
+	quo = res[1]
+
+	// 0 <= rem <= r-1: both rem and r-1-rem must fit in the bit length of r-1.
+	// For a power of two the first check is already exact.
+	remBits := big.NewInt(r - 1).BitLen()
+	assertBitLen(api, rem, remBits)
+	if !Factor(r).IsPowerOfTwo() {
+		assertBitLen(api, api.Sub(r-1, rem), remBits)
+	}
+
+	// -2^(n-1) <= quo < 2^(n-1): shifting by 2^(n-1) gives an n bit number
+	nbBits := ValueBits(api)
+	offset := new(big.Int).Lsh(big.NewInt(1), uint(nbBits-1))
+	assertBitLen(api, api.Add(quo, offset), nbBits)
+
+	api.AssertIsEqual(a, api.Add(api.Mul(quo, r), rem))
+	return quo, rem
+}
+
+// assertBitLen constrains v to be a non-negative integer below 2^nbBits, with
+// the range checker every API of the circuit shares
+func assertBitLen(api frontend.API, v frontend.Variable, nbBits int) {
+	if nbBits == 0 {
+		api.AssertIsEqual(v, 0)
+		return
+	}
+	rangecheck.New(api).Check(v, nbBits)
+}
@@ -0,0 +1,118 @@
+package fixedpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Decimal is a number read exactly from JSON. Decoding into float64 turns
+// 0.29 into 0.28999..., which truncates to 289 at scale 1000; a Decimal keeps
+// it as 29/100 so it quantizes to exactly 290.
+type Decimal struct {
+	r *big.Rat // nil means zero
+}
+
+// ParseDecimal reads a decimal number such as "0.29", "-3" or "1.5e-3"
+func ParseDecimal(s string) (Decimal, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid number %q", s)
+	}
+	return Decimal{r: r}, nil
+}
+
+// MustDecimal is like ParseDecimal but panics on invalid input
+func MustDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Rat returns a copy of the exact value
+func (d Decimal) Rat() *big.Rat {
+	if d.r == nil {
+		return new(big.Rat)
+	}
+	return new(big.Rat).Set(d.r)
+}
+
+// Float returns the nearest float64
+func (d Decimal) Float() float64 {
+	f, _ := d.Rat().Float64()
+	return f
+}
+
+// String prints the exact value in decimal notation when it has one
+func (d Decimal) String() string {
+	r := d.Rat()
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	// a fraction a/(2^i 5^j) has exactly max(i, j) decimal digits
+	den := new(big.Int).Set(r.Denom())
+	digits := 0
+	for _, p := range []int64{2, 5} {
+		n, m, q := 0, new(big.Int), big.NewInt(p)
+		for {
+			quo, rem := new(big.Int).QuoRem(den, q, m)
+			if rem.Sign() != 0 {
+				break
+			}
+			den = quo
+			n++
+		}
+		if n > digits {
+			digits = n
+		}
+	}
+	if den.Cmp(big.NewInt(1)) != 0 {
+		// not a finite decimal, only reachable for values built from fractions
+		return r.RatString()
+	}
+	return r.FloatString(digits)
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	s := d.String()
+	if strings.Contains(s, "/") {
+		// JSON numbers can't hold a fraction, keep it exact as a string
+		return json.Marshal(s)
+	}
+	return []byte(s), nil
+}
+
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	// accept both numbers and the quoted form MarshalJSON uses for fractions
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		var s string
+		if json.Unmarshal(b, &s) != nil {
+			return err
+		}
+		n = json.Number(s)
+	}
+	v, err := ParseDecimal(n.String())
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// Quantize converts d to fixed point at the given scale. With the Exact mode
+// it is an error if d*scale is not an integer; the other modes round it.
+func Quantize(d Decimal, scale int64, mode Rounding) (Value, error) {
+	v := d.Rat()
+	v.Mul(v, new(big.Rat).SetInt64(scale))
+	if v.IsInt() {
+		return Value{V: new(big.Int).Set(v.Num()), Scale: scale}, nil
+	}
+	if mode == Exact {
+		return Value{}, fmt.Errorf("%s is not a multiple of 1/%d", d, scale)
+	}
+	return Value{V: divRound(v.Num(), v.Denom(), mode), Scale: scale}, nil
+}
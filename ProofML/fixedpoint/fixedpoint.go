@@ -0,0 +1,95 @@
+// Package fixedpoint implements the signed fixed-point arithmetic used by
+// ProveModelCircuit, once as circuit gadgets (Fixed) and once on the host
+// (Value). Both sides use the same integer operations and the same floor
+// rounding, so a forward pass computed on the host gives exactly the values
+// the circuit constrains.
+//
+// A real number x is stored as the integer x*scale. Negative numbers are kept
+// as p-|x| in the circuit, the way api.Sub and api.Mul produce them.
+package fixedpoint
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Scale is the default number of fixed-point steps per unit, 1.0 is stored as 1000
+const Scale = 1000
+
+// Value is the host-side twin of Fixed
+type Value struct {
+	V     *big.Int // scaled integer
+	Scale int64    // number of steps per unit
+}
+
+// NewValue returns the fixed-point value v/scale
+func NewValue(v int64, scale int64) Value {
+	return Value{V: big.NewInt(v), Scale: scale}
+}
+
+// Add returns a+b, both values must have the same scale
+func (a Value) Add(b Value) Value {
+	mustMatch(a.Scale, b.Scale)
+	return Value{V: new(big.Int).Add(a.V, b.V), Scale: a.Scale}
+}
+
+// Sub returns a-b, both values must have the same scale
+func (a Value) Sub(b Value) Value {
+	mustMatch(a.Scale, b.Scale)
+	return Value{V: new(big.Int).Sub(a.V, b.V), Scale: a.Scale}
+}
+
+// Mul returns a*b, the result has the product of both scales
+func (a Value) Mul(b Value) Value {
+	return Value{V: new(big.Int).Mul(a.V, b.V), Scale: a.Scale * b.Scale}
+}
+
+// Rescale converts a to the smaller scale with the same rounding as API.Rescale
+func (a Value) Rescale(scale int64, mode Rounding) Value {
+	return Value{V: divRound(a.V, big.NewInt(rescaleFactor(a.Scale, scale)), mode), Scale: scale}
+}
+
+// Cmp returns -1, 0 or 1 depending on whether a is less than, equal to or greater than b
+func (a Value) Cmp(b Value) int {
+	mustMatch(a.Scale, b.Scale)
+	return a.V.Cmp(b.V)
+}
+
+// IsNegative reports whether a < 0
+func (a Value) IsNegative() bool {
+	return a.V.Sign() < 0
+}
+
+// Float returns the real number a stands for
+func (a Value) Float() float64 {
+	f, _ := new(big.Rat).SetFrac(a.V, big.NewInt(a.Scale)).Float64()
+	return f
+}
+
+// Decimal returns the exact real number a stands for
+func (a Value) Decimal() Decimal {
+	return Decimal{r: new(big.Rat).SetFrac(a.V, big.NewInt(a.Scale))}
+}
+
+// Variable returns the scaled integer for use in a circuit assignment.
+// Negative values are reduced into the field when the witness is built.
+func (a Value) Variable() *big.Int {
+	return new(big.Int).Set(a.V)
+}
+
+func (a Value) String() string {
+	return fmt.Sprintf("%s/%d", a.V, a.Scale)
+}
+
+func mustMatch(a, b int64) {
+	if a != b {
+		panic(fmt.Sprintf("fixedpoint: scale mismatch %d != %d", a, b))
+	}
+}
+
+func rescaleFactor(from, to int64) int64 {
+	if to <= 0 || from < to || from%to != 0 {
+		panic(fmt.Sprintf("fixedpoint: cannot rescale from %d to %d", from, to))
+	}
+	return from / to
+}
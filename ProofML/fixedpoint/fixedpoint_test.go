@@ -0,0 +1,302 @@
+package fixedpoint
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint/solver"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/test"
+)
+
+// smallModCircuit checks the quotient and remainder SmallMod returns for A
+type smallModCircuit struct {
+	A   frontend.Variable `gnark:",public"`
+	Quo frontend.Variable
+	Rem frontend.Variable
+}
+
+func (c *smallModCircuit) Define(api frontend.API) error {
+	quo, rem := SmallMod(api, c.A, 1000)
+	api.AssertIsEqual(quo, c.Quo)
+	api.AssertIsEqual(rem, c.Rem)
+	return nil
+}
+
+// rescaleCircuit only calls SmallMod, so any failure comes from the gadget's own constraints
+type rescaleCircuit struct {
+	A frontend.Variable `gnark:",public"`
+}
+
+func (c *rescaleCircuit) Define(api frontend.API) error {
+	SmallMod(api, c.A, 1000)
+	return nil
+}
+
+// tamperedHint runs the honest hint and then lets tamper rewrite its outputs,
+// the way a malicious prover would.
+func tamperedHint(tamper func(p, r, quo, rem *big.Int)) solver.Hint {
+	return func(mod *big.Int, inputs []*big.Int, outputs []*big.Int) error {
+		if err := smallModHint(mod, inputs, outputs); err != nil {
+			return err
+		}
+		tamper(mod, inputs[1], outputs[1], outputs[0])
+		outputs[0].Mod(outputs[0], mod)
+		outputs[1].Mod(outputs[1], mod)
+		return nil
+	}
+}
+
+func TestSmallModSigned(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	field := ecc.BN254.ScalarField()
+	neg := func(x int64) *big.Int {
+		return new(big.Int).Sub(field, big.NewInt(x))
+	}
+
+	assert.NoError(test.IsSolved(&smallModCircuit{}, &smallModCircuit{A: 1234567, Quo: 1234, Rem: 567}, field))
+	assert.NoError(test.IsSolved(&smallModCircuit{}, &smallModCircuit{A: 0, Quo: 0, Rem: 0}, field))
+	assert.NoError(test.IsSolved(&smallModCircuit{}, &smallModCircuit{A: 999, Quo: 0, Rem: 999}, field))
+	// -1234567 = -1235*1000 + 433
+	assert.NoError(test.IsSolved(&smallModCircuit{}, &smallModCircuit{A: neg(1234567), Quo: neg(1235), Rem: 433}, field))
+	assert.NoError(test.IsSolved(&smallModCircuit{}, &smallModCircuit{A: neg(1000), Quo: neg(1), Rem: 0}, field))
+
+	// the truncated quotient is not accepted for negative values
+	assert.Error(test.IsSolved(&smallModCircuit{}, &smallModCircuit{A: neg(1234567), Quo: neg(1234), Rem: neg(567)}, field))
+}
+
+func TestSmallModTamperedHint(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	field := ecc.BN254.ScalarField()
+	ccs, err := frontend.Compile(field, r1cs.NewBuilder, &rescaleCircuit{})
+	assert.NoError(err)
+	pk, vk, err := groth16.Setup(ccs)
+	assert.NoError(err)
+
+	// 1234001 = 1234*1000 + 1, small enough remainder for the wrap-around attack
+	witness, err := frontend.NewWitness(&rescaleCircuit{A: 1234001}, field)
+	assert.NoError(err)
+
+	// the honest hint proves and verifies
+	proof, err := groth16.Prove(ccs, pk, witness)
+	assert.NoError(err)
+	publicWitness, err := witness.Public()
+	assert.NoError(err)
+	assert.NoError(groth16.Verify(proof, vk, publicWitness))
+
+	one := big.NewInt(1)
+	cases := map[string]func(p, r, quo, rem *big.Int){
+		"wrong quotient": func(p, r, quo, rem *big.Int) {
+			quo.Add(quo, one)
+		},
+		"remainder above modulus": func(p, r, quo, rem *big.Int) {
+			quo.Sub(quo, one)
+			rem.Add(rem, r)
+		},
+		"negative remainder": func(p, r, quo, rem *big.Int) {
+			quo.Add(quo, one)
+			rem.Sub(rem, r)
+		},
+		"quotient wrapping the field": func(p, r, quo, rem *big.Int) {
+			// quo - 1/r and rem + 1 still satisfy a == quo*r + rem mod p
+			quo.Sub(quo, new(big.Int).ModInverse(r, p))
+			rem.Add(rem, one)
+		},
+	}
+	for name, tamper := range cases {
+		_, err := groth16.Prove(ccs, pk, witness,
+			backend.WithSolverOptions(solver.OverrideHint(solver.GetHintID(smallModHint), tamperedHint(tamper))))
+		assert.Error(err, name)
+	}
+}
+
+// signCircuit checks IsNegative of A
+type signCircuit struct {
+	A        frontend.Variable `gnark:",public"`
+	Negative frontend.Variable `gnark:",public"`
+}
+
+func (c *signCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(NewAPI(api).IsNegative(New(c.A, Scale)), c.Negative)
+	return nil
+}
+
+func TestSignBitTamperedHint(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	field := ecc.BN254.ScalarField()
+	ccs, err := frontend.Compile(field, r1cs.NewBuilder, &signCircuit{})
+	assert.NoError(err)
+	flipped := solver.OverrideHint(solver.GetHintID(topBitHint), func(mod *big.Int, inputs []*big.Int, outputs []*big.Int) error {
+		if err := topBitHint(mod, inputs, outputs); err != nil {
+			return err
+		}
+		outputs[0].Xor(outputs[0], big.NewInt(1))
+		return nil
+	})
+	// 2^(ValueBits-1), the smallest value above the signed range
+	huge := new(big.Int).Lsh(big.NewInt(1), uint(field.BitLen()/2-3))
+	for _, c := range []struct {
+		a        *big.Int
+		negative int
+	}{
+		{big.NewInt(1234), 0},
+		{big.NewInt(0), 0},
+		{new(big.Int).Sub(field, big.NewInt(1)), 1},
+	} {
+		witness, err := frontend.NewWitness(&signCircuit{A: c.a, Negative: c.negative}, field)
+		assert.NoError(err)
+		assert.NoError(ccs.IsSolved(witness), c.a)
+
+		// claiming the other sign, with or without the hint's help, fails
+		witness, err = frontend.NewWitness(&signCircuit{A: c.a, Negative: 1 - c.negative}, field)
+		assert.NoError(err)
+		assert.Error(ccs.IsSolved(witness, flipped), c.a)
+	}
+
+	// values outside ValueBits can't be compared
+	witness, err := frontend.NewWitness(&signCircuit{A: huge, Negative: 0}, field)
+	assert.NoError(err)
+	assert.Error(ccs.IsSolved(witness))
+}
+
+// twinCircuit evaluates rescale(A*B + C) and the comparisons the model uses
+type twinCircuit struct {
+	A, B, C  frontend.Variable
+	Res      frontend.Variable `gnark:",public"`
+	IsLess   frontend.Variable `gnark:",public"`
+	Cmp      frontend.Variable `gnark:",public"`
+	Negative frontend.Variable `gnark:",public"`
+
+	Scale int64    `gnark:"-"`
+	Mode  Rounding `gnark:"-"`
+}
+
+func (c *twinCircuit) Define(api frontend.API) error {
+	fp := NewAPI(api)
+	a, b := New(c.A, c.Scale), New(c.B, c.Scale)
+	res := fp.Rescale(fp.Add(fp.Mul(a, b), New(c.C, c.Scale*c.Scale)), c.Scale, c.Mode)
+	api.AssertIsEqual(res.V, c.Res)
+	api.AssertIsEqual(fp.IsLess(a, b), c.IsLess)
+	api.AssertIsEqual(fp.Cmp(a, b), c.Cmp)
+	api.AssertIsEqual(fp.IsNegative(res), c.Negative)
+	return nil
+}
+
+func TestHostTwin(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	values := []string{"0", "0.001", "-0.001", "0.29", "-0.29", "1.5", "-1.5", "3.75", "-12.345"}
+	for _, scale := range []int64{Scale, 1 << 10} {
+		for _, mode := range []Rounding{Truncate, Floor, Ceil, HalfUp} {
+			// the witness reduces negative values into the field, like the prover does
+			field := ecc.BN254.ScalarField()
+			ccs, err := frontend.Compile(field, r1cs.NewBuilder, &twinCircuit{Scale: scale, Mode: mode})
+			assert.NoError(err)
+
+			for _, x := range values {
+				for _, y := range values {
+					a, err := Quantize(MustDecimal(x), scale, mode)
+					assert.NoError(err)
+					b, err := Quantize(MustDecimal(y), scale, mode)
+					assert.NoError(err)
+					c, err := Quantize(Decimal{r: new(big.Rat).Sub(MustDecimal(x).Rat(), MustDecimal(y).Rat())}, scale*scale, mode)
+					assert.NoError(err)
+					res := a.Mul(b).Add(c).Rescale(scale, mode)
+
+					boolean := func(v bool) int {
+						if v {
+							return 1
+						}
+						return 0
+					}
+					assignment := &twinCircuit{
+						A: a.Variable(), B: b.Variable(), C: c.Variable(),
+						Res:      res.Variable(),
+						IsLess:   boolean(a.Cmp(b) < 0),
+						Cmp:      a.Cmp(b),
+						Negative: boolean(res.IsNegative()),
+					}
+					witness, err := frontend.NewWitness(assignment, field)
+					assert.NoError(err)
+					assert.NoError(ccs.IsSolved(witness), "%s %d: %v * %v", mode, scale, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestRescaleRounding(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	cases := []struct {
+		v                             int64
+		truncate, floor, ceil, halfUp int64
+	}{
+		{1499, 1, 1, 2, 1},
+		{1500, 1, 1, 2, 2},
+		{-1499, -1, -2, -1, -1},
+		{-1500, -1, -2, -1, -1},
+		{-1501, -1, -2, -1, -2},
+		{-1000, -1, -1, -1, -1},
+	}
+	for _, c := range cases {
+		v := NewValue(c.v, 1000*1000)
+		assert.Equal(c.truncate, v.Rescale(1000, Truncate).V.Int64(), "truncate %d", c.v)
+		assert.Equal(c.floor, v.Rescale(1000, Floor).V.Int64(), "floor %d", c.v)
+		assert.Equal(c.ceil, v.Rescale(1000, Ceil).V.Int64(), "ceil %d", c.v)
+		assert.Equal(c.halfUp, v.Rescale(1000, HalfUp).V.Int64(), "half-up %d", c.v)
+	}
+
+	for _, s := range []string{"1000", "10^3", "1e3"} {
+		f, err := ParseFactor(s)
+		assert.NoError(err)
+		assert.Equal(Factor(1000), f)
+	}
+	f, err := ParseFactor("2^10")
+	assert.NoError(err)
+	assert.True(f.IsPowerOfTwo())
+	_, err = ParseFactor("0")
+	assert.Error(err)
+}
+
+func TestQuantizeDecimal(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	// 0.29 is 0.28999... as a float64 and used to become 289
+	v, err := Quantize(MustDecimal("0.29"), 1000, Exact)
+	assert.NoError(err)
+	assert.Equal(int64(290), v.V.Int64())
+
+	v, err = Quantize(MustDecimal("-0.13"), 1000*1000, Exact)
+	assert.NoError(err)
+	assert.Equal(int64(-130000), v.V.Int64())
+
+	_, err = Quantize(MustDecimal("0.2915"), 1000, Exact)
+	assert.Error(err)
+	_, err = Quantize(MustDecimal("0.001"), 1<<10, Exact)
+	assert.Error(err)
+
+	v, err = Quantize(MustDecimal("-0.2915"), 1000, Truncate)
+	assert.NoError(err)
+	assert.Equal(int64(-291), v.V.Int64())
+	v, err = Quantize(MustDecimal("-0.2915"), 1000, Floor)
+	assert.NoError(err)
+	assert.Equal(int64(-292), v.V.Int64())
+	v, err = Quantize(MustDecimal("-0.2915"), 1000, HalfUp)
+	assert.NoError(err)
+	assert.Equal(int64(-291), v.V.Int64())
+
+	var d Decimal
+	assert.NoError(json.Unmarshal([]byte("1.5e-3"), &d))
+	b, err := json.Marshal(d)
+	assert.NoError(err)
+	assert.Equal("0.0015", string(b))
+}
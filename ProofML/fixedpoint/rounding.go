@@ -0,0 +1,159 @@
+package fixedpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Rounding selects what happens to the digits that are dropped when a value
+// is quantized or rescaled.
+type Rounding string
+
+const (
+	Exact    Rounding = "exact"    // no rounding, quantizing a value that needs it is an error
+	Truncate Rounding = "truncate" // towards zero
+	Floor    Rounding = "floor"    // towards negative infinity
+	Ceil     Rounding = "ceil"     // towards positive infinity
+	HalfUp   Rounding = "half-up"  // to the nearest step, halves go up
+)
+
+// Validate reports an error for unknown rounding modes
+func (r Rounding) Validate() error {
+	switch r {
+	case Exact, Truncate, Floor, Ceil, HalfUp:
+		return nil
+	}
+	return fmt.Errorf("unknown rounding mode %q, expected %q, %q, %q, %q or %q", string(r), Exact, Truncate, Floor, Ceil, HalfUp)
+}
+
+// Factor is a scale, the number of fixed-point steps per unit. In JSON it is
+// written either as a number (1000) or as a power ("10^3", "2^10").
+type Factor int64
+
+// IsPowerOfTwo reports whether rescaling by f is a plain bit shift
+func (f Factor) IsPowerOfTwo() bool {
+	return f > 0 && f&(f-1) == 0
+}
+
+func (f Factor) String() string {
+	if f.IsPowerOfTwo() {
+		return fmt.Sprintf("2^%d", bits.TrailingZeros64(uint64(f)))
+	}
+	exp, v := 0, int64(f)
+	for v > 1 && v%10 == 0 {
+		v /= 10
+		exp++
+	}
+	if v == 1 {
+		return fmt.Sprintf("10^%d", exp)
+	}
+	return strconv.FormatInt(int64(f), 10)
+}
+
+// ParseFactor reads a scale written as "1000", "10^3", "1e3" or "2^10"
+func ParseFactor(s string) (Factor, error) {
+	s = strings.TrimSpace(s)
+	var base, exp int64
+	var err error
+	switch {
+	case strings.Contains(s, "^"):
+		parts := strings.SplitN(s, "^", 2)
+		if base, err = strconv.ParseInt(parts[0], 10, 64); err == nil {
+			exp, err = strconv.ParseInt(parts[1], 10, 64)
+		}
+	case strings.ContainsAny(s, "eE"):
+		parts := strings.FieldsFunc(s, func(r rune) bool { return r == 'e' || r == 'E' })
+		if len(parts) != 2 {
+			return 0, fmt.Errorf("invalid scale %q", s)
+		}
+		var mant int64
+		if mant, err = strconv.ParseInt(parts[0], 10, 64); err == nil && mant != 1 {
+			return 0, fmt.Errorf("invalid scale %q, expected 1eN", s)
+		}
+		base = 10
+		exp, err = strconv.ParseInt(parts[1], 10, 64)
+	default:
+		exp = 1
+		base, err = strconv.ParseInt(s, 10, 64)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid scale %q: %w", s, err)
+	}
+
+	v := new(big.Int).Exp(big.NewInt(base), big.NewInt(exp), nil)
+	if base <= 0 || exp < 0 || !v.IsInt64() || v.Sign() <= 0 {
+		return 0, fmt.Errorf("scale %q is not a positive 64 bit integer", s)
+	}
+	return Factor(v.Int64()), nil
+}
+
+func (f Factor) MarshalJSON() ([]byte, error) {
+	if f.IsPowerOfTwo() && f > 1 {
+		return json.Marshal(f.String())
+	}
+	return json.Marshal(int64(f))
+}
+
+func (f *Factor) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		// a plain number
+		s = string(b)
+	}
+	v, err := ParseFactor(s)
+	if err != nil {
+		return err
+	}
+	*f = v
+	return nil
+}
+
+// Factors is a list of per-layer scales. A single scale in JSON applies to every layer.
+type Factors []Factor
+
+// At returns the scale of layer i
+func (f Factors) At(i int) int64 {
+	if len(f) == 1 {
+		return int64(f[0])
+	}
+	return int64(f[i])
+}
+
+func (f *Factors) UnmarshalJSON(b []byte) error {
+	var list []Factor
+	if err := json.Unmarshal(b, &list); err == nil {
+		*f = list
+		return nil
+	}
+	var single Factor
+	if err := json.Unmarshal(b, &single); err != nil {
+		return err
+	}
+	*f = Factors{single}
+	return nil
+}
+
+// divRound divides a by the positive d with the given rounding, the host-side
+// twin of API.Rescale.
+func divRound(a, d *big.Int, mode Rounding) *big.Int {
+	switch mode {
+	case Truncate:
+		return new(big.Int).Quo(a, d)
+	case Ceil:
+		// ceil(a/d) == -floor(-a/d)
+		q := new(big.Int).Div(new(big.Int).Neg(a), d)
+		return q.Neg(q)
+	case HalfUp:
+		// floor(a/r + 1/2) == floor((2a + r) / 2r)
+		num := new(big.Int).Lsh(a, 1)
+		num.Add(num, d)
+		return num.Div(num, new(big.Int).Lsh(d, 1))
+	default:
+		// Div is Euclidean division, which is floor division for a positive divisor
+		return new(big.Int).Div(a, d)
+	}
+}
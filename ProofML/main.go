@@ -2,154 +2,47 @@ package main
 
 import (
 	"encoding/json"
-	"errors"
+	"flag"
 	"fmt"
-	"math/big"
 	"os"
 	"runtime"
 
+	"sudokuChecker/bundle"
+	"sudokuChecker/fixedpoint"
+	"sudokuChecker/nn"
+	"sudokuChecker/proofsystem"
+
 	"github.com/consensys/gnark-crypto/ecc"
-	"github.com/consensys/gnark/backend/groth16"
-	"github.com/consensys/gnark/constraint/solver"
 	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/frontend/cs/r1cs"
-	"github.com/consensys/gnark/std/math/cmp"
 )
 
 const (
 	pubInputFile = "public.json"
 	priInputFile = "private.json"
-	vkKeyFile    = "vk.g16vk"
-	proofFile    = "proof.g16p"
-)
+	metaFile     = "proof.meta.json"
+	bundleFile   = "proof.bundle.json"
 
-// ProveModelCircuit defines the circuit structure for the neural network
-type ProveModelCircuit struct {
-	Weights  [2][3][3]frontend.Variable `gnark:",private"` // Weights as 3D slices
-	Biases   [2][3]frontend.Variable    `gnark:",private"` // Biases as 2D slices
-	Inputs   [10][3]frontend.Variable   `gnark:",public"`  // Input vectors as a 2D slice
-	Expected [10]frontend.Variable      `gnark:",private"` // Expected outputs as a 1D slice
-}
+	lipschitzBundleFile = "lipschitz.bundle.json"
+)
 
-func smallModHint(mod *big.Int, inputs []*big.Int, outputs []*big.Int) error {
-	// computes a % r = b
-	// inputs[0] = a -- input
-	// inputs[1] = r -- modulus
-	// outputs[0] = b -- remainder
-	// outputs[1] = (a-b)/r -- quotient
-	if len(outputs) != 2 {
-		return errors.New("expected 2 outputs")
+// writeLipschitz writes the verifying key, the proof and the metadata of a
+// Lipschitz proof, and a bundle of them
+func writeLipschitz(backend proofsystem.Backend, p *nn.LipschitzProof) error {
+	vkFile, proofFile := nn.LipschitzFiles(backend)
+	if err := proofsystem.WriteTo(vkFile, p.VK); err != nil {
+		return err
 	}
-	if len(inputs) != 2 {
-		return errors.New("expected 2 inputs")
+	if err := proofsystem.WriteTo(proofFile, p.Proof); err != nil {
+		return err
 	}
-	outputs[1].QuoRem(inputs[0], inputs[1], outputs[0])
-	fmt.Println(outputs[0], outputs[1], inputs[0], inputs[1])
-	return nil
-}
-
-func SmallMod(api frontend.API, a, r frontend.Variable) (quo, rem frontend.Variable) {
-
-	res, err := api.Compiler().NewHint(smallModHint, 2, a, r)
-	if err != nil {
-		panic(err)
+	if err := nn.WriteJSON(nn.LipschitzMetaFile, p.Meta); err != nil {
+		return err
 	}
-	rem = res[0]
-	quo = res[1]
-
-	// to prevent against overflows, we assume that the inputs are small relative to the native field
-	//nbBits := api.Compiler().Field().BitLen()/2 - 2
-	//bound := new(big.Int).Lsh(big.NewInt(1), uint(nbBits))
-	// api.AssertIsLessOrEqual(rem, bound)
-	// api.AssertIsLessOrEqual(quo, bound)
-
-	// api.AssertIsEqual(a, api.Add(api.Mul(quo, r), rem))
-	return quo, rem
-}
-
-func scaleDown(api frontend.API, value frontend.Variable) frontend.Variable {
-	// Compute quotient = value / 1000
-	quotient := api.Div(value, 1000)
-
-	// Compute nearest multiple = quotient * 1000
-	nearestMultiple := api.Mul(quotient, 1000)
-
-	// Compute remainder = value - nearestMultiple
-	remainder := api.Sub(value, nearestMultiple)
-
-	// Check if remainder >= 500
-	isAboveThreshold := cmp.IsLess(api, 500, remainder)
-
-	// Calculate adjustments
-	roundUp := api.Sub(1000, remainder) // Amount to add for rounding up
-	roundDown := api.Neg(remainder)     // Amount to subtract for rounding down
-
-	// Conditionally apply round up or round down
-	adjustment := api.Select(isAboveThreshold, roundUp, roundDown)
-
-	// Apply the adjustment and return the scaled value
-	return api.Add(value, adjustment)
-}
-
-func (circuit *ProveModelCircuit) Define(api frontend.API) error {
-	largeBoundary := frontend.Variable(1000000000)
-
-	// Iterate over each input vector
-	for k := 0; k < len(circuit.Inputs); k++ {
-		layerOutputs := circuit.Inputs[k] // Start with the input vector
-
-		// Iterate over each layer
-		for layer := 0; layer < len(circuit.Weights); layer++ {
-			// Create a new slice for the outputs
-			newOutputs := make([]frontend.Variable, len(circuit.Weights[layer]))
-
-			// Iterate over each neuron in the layer
-			for i := 0; i < len(circuit.Weights[layer]); i++ {
-				sum := circuit.Biases[layer][i]
-
-				// Compute the weighted sum
-				for j := 0; j < len(circuit.Weights[layer][i]); j++ {
-					tmp := api.Mul(circuit.Weights[layer][i][j], layerOutputs[j])
-					sum = api.Add(sum, tmp)
-				}
-
-				// Apply the scale-down function
-				sum, rem := SmallMod(api, sum, 1000)
-				api.Println(sum, "numb", rem)
-				// Apply ReLU activation
-				newOutputs[i] = applyReLU(api, sum, largeBoundary)
-			}
-
-			// Update layerOutputs by iterating through elements
-			for i := range newOutputs {
-				layerOutputs[i] = newOutputs[i]
-			}
-
-			// Print the outputs after the current layer
-			api.Println("Outputs after layer", layer, ":", layerOutputs)
-		}
-
-		// Find the argmax in the final layer's output
-		maxVal := layerOutputs[0]
-		maxIdx := frontend.Variable(0)
-		for i := 1; i < len(layerOutputs); i++ {
-			isLess := cmp.IsLess(api, maxVal, layerOutputs[i])
-			maxVal = api.Select(isLess, layerOutputs[i], maxVal)
-			maxIdx = api.Select(isLess, frontend.Variable(i), maxIdx)
-		}
-
-		// Assert the predicted output matches the expected output
-		api.AssertIsEqual(maxIdx, circuit.Expected[k])
+	b, err := bundle.New(bundle.Model("lipschitz", backend, p.Meta.Shape, p.Meta.Quantization), p.VK, p.PublicWitness, p.Proof)
+	if err != nil {
+		return err
 	}
-
-	return nil
-}
-
-// Apply ReLU activation function with scaling
-func applyReLU(api frontend.API, value, largeBoundary frontend.Variable) frontend.Variable {
-	isNegative := cmp.IsLess(api, value, 0)
-	isLarge := cmp.IsLess(api, largeBoundary, value)
-	return api.Select(api.Or(isNegative, isLarge), frontend.Variable(0), value)
+	return b.Write(lipschitzBundleFile)
 }
 
 func main() {
@@ -157,97 +50,185 @@ func main() {
 
 	// Print the number of CPU cores in use
 	fmt.Println("Number of CPU cores in use:", runtime.GOMAXPROCS(0))
-	solver.RegisterHint(smallModHint)
-	// Open the JSON files
-	weightsFile, err := os.Open("weights.json")
+
+	ballFile := flag.String("ball", "", "initialPoint.json to check every input against, empty to skip")
+	certifyFile := flag.String("certify", "", "box to certify, in the initialPoint.json format plus a \"label\", empty to skip")
+	sameLabel := flag.Bool("same-label", false, "prove that every input and the ball center get one public label, the class in outputs.json")
+	marginFlag := flag.String("margin", "", "margin every input has to win by, such as 0.05, empty for none")
+	reportMargin := flag.Bool("report-margin", false, "publish the smallest margin the inputs win by")
+	lipschitz := flag.String("lipschitz", "", "only prove that the Lipschitz bound of weights.json is at most this value")
+	commitOnly := flag.Bool("commit", false, "only print the commitment of weights.json, to pin the model a verifier accepts")
+	simulateOnly := flag.Bool("simulate", false, "only run the circuit's forward pass on inputs.json, print every layer and write the predicted classes to outputs.json")
+	overflowOnly := flag.Bool("overflow", false, "only print the worst-case size of every layer's sums for the inputs, ball and box, and the headroom the field leaves them")
+	inputBound := flag.String("input-bound", "", "largest absolute input value the overflow analysis has to cover, such as 10, empty to only cover the files")
+	quantOnly := flag.Bool("quant-report", false, "only compare the circuit's fixed-point forward pass on inputs.json with float64 and print the error of every layer")
+	keysDir := flag.String("keys", "keys", "directory keeping the compiled circuit and the keys of every shape set up so far")
+	onnxFile := flag.String("onnx", "", "model.onnx to import instead of reading weights.json")
+	onnxOut := flag.String("onnx-out", "", "also write the imported model in the weights.json format to this file")
+	backendName := flag.String("backend", "groth16", "proof system, groth16 with a setup per circuit or plonk with a universal SRS")
+	srsFile := flag.String("srs", "", "universal KZG SRS for plonk, empty to generate an unsafe one for testing")
+	flag.Parse()
+
+	backend, err := proofsystem.New(*backendName, *srsFile)
 	if err != nil {
-		fmt.Println("Error opening weights file:", err)
+		fmt.Println("Error choosing backend:", err)
 		return
 	}
-	defer weightsFile.Close()
-
-	inputsFile, err := os.Open("inputs.json")
+	setupID, err := backend.SetupID()
 	if err != nil {
-		fmt.Println("Error opening inputs file:", err)
+		fmt.Println("Error reading SRS:", err)
 		return
 	}
-	defer inputsFile.Close()
+	if setupID == proofsystem.UnsafeSetup {
+		fmt.Fprintln(os.Stderr, proofsystem.UnsafeSetupWarning)
+	}
+	store := nn.KeyStore{Dir: *keysDir, Backend: backend}
 
-	outputsFile, err := os.Open("outputs.json")
+	// Load the model, the inputs and the expected outputs
+	var weightsData *nn.ModelData
+	if *onnxFile != "" {
+		weightsData, err = nn.LoadONNX(*onnxFile, nn.DefaultONNXQuant())
+	} else {
+		weightsData, err = nn.LoadModel("weights.json")
+	}
 	if err != nil {
-		fmt.Println("Error opening outputs file:", err)
+		fmt.Println("Error loading weights file:", err)
+		return
+	}
+	if *onnxOut != "" {
+		if err := nn.WriteJSON(*onnxOut, weightsData); err != nil {
+			fmt.Println("Error writing imported model:", err)
+			return
+		}
+	}
+	if *commitOnly {
+		shape, err := weightsData.Shape()
+		if err != nil {
+			fmt.Println("Error checking shapes:", err)
+			return
+		}
+		weights, biases, err := weightsData.Quantize()
+		if err != nil {
+			fmt.Println("Error quantizing:", err)
+			return
+		}
+		fmt.Println(nn.ModelDigest(shape, weightsData.Quant(), weights, biases))
+		return
+	}
+	if *lipschitz != "" {
+		bound, err := fixedpoint.ParseDecimal(*lipschitz)
+		if err != nil {
+			fmt.Println("Error reading Lipschitz bound:", err)
+			return
+		}
+		p, err := nn.ProveLipschitz(store, weightsData, bound)
+		if err != nil {
+			fmt.Println("Error proving Lipschitz bound:", err)
+			return
+		}
+		if err := writeLipschitz(backend, p); err != nil {
+			fmt.Println("Error writing Lipschitz proof:", err)
+			return
+		}
+		fmt.Println("Lipschitz bound", p.Meta.Bound, "proven and verified, see", nn.LipschitzMetaFile, "and", lipschitzBundleFile)
 		return
 	}
-	defer outputsFile.Close()
-
-	// Define the data structures for weights, inputs, and expected outputs
-	weightsData := struct {
-		Weights [][][]float64 `json:"weights"`
-		Biases  [][]float64   `json:"biases"`
-	}{}
-
-	inputData := struct {
-		Inputs [][]float64 `json:"inputs"`
-	}{}
-
-	expectedData := struct {
-		Expected []float64 `json:"outputs"`
-	}{}
-
-	// Decode the JSON files into the structs
-	_ = json.NewDecoder(weightsFile).Decode(&weightsData)
-	_ = json.NewDecoder(inputsFile).Decode(&inputData)
-	_ = json.NewDecoder(outputsFile).Decode(&expectedData)
-
-	// Create the circuit and initialize it
-	assignment := &ProveModelCircuit{}
 
-	for layer := 0; layer < len(weightsData.Weights); layer++ {
+	inputData, err := nn.LoadInputs("inputs.json")
+	if err != nil {
+		fmt.Println("Error loading inputs file:", err)
+		return
+	}
+	if *simulateOnly {
+		// compare against the old labels when there are any, then replace them
+		previous, _ := nn.LoadExpected("outputs.json")
+		if previous != nil && len(previous.Expected) != len(inputData.Inputs) {
+			previous = nil
+		}
+		predictions, err := nn.Simulate(os.Stdout, weightsData, inputData, previous)
+		if err != nil {
+			fmt.Println("Error simulating:", err)
+			return
+		}
+		if err := nn.WriteJSON("outputs.json", &nn.ExpectedData{Expected: predictions}); err != nil {
+			fmt.Println("Error writing outputs file:", err)
+		}
+		return
+	}
+	if *quantOnly {
+		if err := nn.QuantReport(os.Stdout, weightsData, inputData); err != nil {
+			fmt.Println("Error comparing with floats:", err)
+		}
+		return
+	}
 
-		for neuron := 0; neuron < len(weightsData.Weights[layer]); neuron++ {
+	expectedData, err := nn.LoadExpected("outputs.json")
+	if err != nil {
+		fmt.Println("Error loading outputs file:", err)
+		return
+	}
 
-			for j := 0; j < len(weightsData.Weights[layer][neuron]); j++ {
-				scaledWeight := new(big.Int).SetInt64(int64(weightsData.Weights[layer][neuron][j] * 1000))
-				assignment.Weights[layer][neuron][j] = frontend.Variable(scaledWeight)
-			}
+	data := &nn.ProverData{Model: weightsData, Inputs: inputData, Expected: expectedData, SameLabel: *sameLabel, ReportMargin: *reportMargin}
+	if *marginFlag != "" {
+		delta, err := fixedpoint.ParseDecimal(*marginFlag)
+		if err != nil {
+			fmt.Println("Error reading margin:", err)
+			return
 		}
+		data.Margin = &delta
 	}
-
-	// Initialize Biases
-	for layer := 0; layer < len(weightsData.Biases); layer++ {
-		for i := 0; i < len(weightsData.Biases[layer]); i++ {
-			scaledBias := new(big.Int).SetInt64(int64(weightsData.Biases[layer][i] * 1000000))
-			assignment.Biases[layer][i] = frontend.Variable(scaledBias)
+	if *inputBound != "" {
+		bound, err := fixedpoint.ParseDecimal(*inputBound)
+		if err != nil {
+			fmt.Println("Error reading input bound:", err)
+			return
 		}
+		data.InputBound = &bound
 	}
-
-	// Initialize Inputs
-	for i := 0; i < len(inputData.Inputs); i++ {
-		for j := 0; j < len(inputData.Inputs[i]); j++ {
-			scaledInput := new(big.Int).SetInt64(int64(inputData.Inputs[i][j] * 1000))
-			assignment.Inputs[i][j] = frontend.Variable(scaledInput)
+	if *ballFile != "" {
+		data.Ball, err = nn.LoadBall(*ballFile)
+		if err != nil {
+			fmt.Println("Error loading ball file:", err)
+			return
+		}
+	}
+	if *certifyFile != "" {
+		data.Certify, err = nn.LoadCertify(*certifyFile)
+		if err != nil {
+			fmt.Println("Error loading certify file:", err)
+			return
 		}
 	}
 
-	// Initialize Expected Outputs
+	if *overflowOnly {
+		if err := nn.OverflowReport(os.Stdout, data); err != nil {
+			fmt.Println("Error analyzing overflow:", err)
+		}
+		return
+	}
 
-	for i := 0; i < len(expectedData.Expected); i++ {
-		scaledExpected := new(big.Int).SetInt64(int64(expectedData.Expected[i]))
-		assignment.Expected[i] = frontend.Variable(scaledExpected)
+	// The circuit is sized from the files, which must agree with each other
+	shape, err := nn.CircuitShape(data)
+	if err != nil {
+		fmt.Println("Error checking shapes:", err)
+		return
 	}
+	fmt.Println("Model shape:", shape.InputSize, shape.LayerSizes, "batch", shape.BatchSize)
 
-	var myCircuit ProveModelCircuit
-	fmt.Print(assignment)
-	// Compile and set up the circuit
-	cs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &myCircuit)
+	// Create the circuit and initialize it
+	assignment, err := nn.NewAssignment(shape, data)
 	if err != nil {
-		fmt.Println("Error compiling circuit:", err)
+		fmt.Println("Error quantizing:", err)
 		return
 	}
 
-	pk, vk, err := groth16.Setup(cs)
+	myCircuit := nn.NewProveModelCircuit(shape, weightsData.Quant())
+	// Compile and set up the circuit, or reuse the keys of an earlier run with the same shape
+	id := nn.CircuitID("model", backend.Name(), shape, weightsData.Quant())
+	fmt.Println("Circuit id:", id)
+	cs, pk, vk, err := store.Setup(id, myCircuit)
 	if err != nil {
-		fmt.Println("Error during setup:", err)
+		fmt.Println("Error setting up circuit:", err)
 		return
 	}
 
@@ -257,33 +238,59 @@ func main() {
 		return
 	}
 
-	proof, err := groth16.Prove(cs, pk, witness)
+	proof, err := backend.Prove(cs, pk, witness)
 	if err != nil {
 		fmt.Println("Error proving:", err)
 		return
 	}
 
-	vkF, _ := os.Create(vkKeyFile)
+	vkF, _ := os.Create(backend.Files().VK)
 
 	defer vkF.Close()
 
 	_, _ = vk.WriteTo(vkF)
 
 	// Write the proof to a file
-	proofF, _ := os.Create(proofFile)
+	proofF, _ := os.Create(backend.Files().Proof)
 
 	defer proofF.Close()
 
 	_, _ = proof.WriteTo(proofF)
 
-	fmt.Println("Proof and verification key files have been successfully generated.")
+	// Record which arithmetic the proof was made with, the verifier needs it to
+	// scale the public inputs and to know what the claimed labels mean
+	metaF, _ := os.Create(metaFile)
+
+	defer metaF.Close()
+
+	encoder := json.NewEncoder(metaF)
+	encoder.SetIndent("", "  ")
+	meta := nn.NewProofMetadata(shape, data, assignment)
+	meta.Setup = setupID
+	if meta.SmallestMargin != nil {
+		fmt.Println("Smallest margin:", *meta.SmallestMargin)
+	}
+	_ = encoder.Encode(meta)
+
+	// Bundle the proof with its public witness and what it was made for, so it
+	// can be checked without any of the other files but the verifying key
 	publicWitness, err := witness.Public()
 	if err != nil {
 		fmt.Println("Error getting public witness:", err)
 		return
 	}
+	b, err := bundle.New(bundle.Model("model", backend, shape, weightsData.Quant()), vk, publicWitness, proof)
+	if err == nil {
+		err = b.Write(bundleFile)
+	}
+	if err != nil {
+		fmt.Println("Error writing proof bundle:", err)
+		return
+	}
+
+	fmt.Println("Proof and verification key files have been successfully generated.")
 
-	err = groth16.Verify(proof, vk, publicWitness)
+	err = backend.Verify(proof, vk, publicWitness)
 	if err != nil {
 		fmt.Println("Verification failed")
 	} else {
@@ -0,0 +1,200 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"sudokuChecker/fixedpoint"
+)
+
+// activationFn is a layer's activation with its parameters quantized. Every
+// activation but GELU is non-decreasing, so interval bounds pass through it by
+// applying it to both ends and max pooling commutes with it. The Lipschitz
+// bound of the weights only covers the network when oneLipschitz holds.
+type activationFn struct {
+	Kind   Activation
+	Slope  fixedpoint.Value // at fixedpoint.Scale, leaky ReLU and hard sigmoid
+	Lo, Hi fixedpoint.Value // output range of the clipping activations, at the layer's output scale
+	Offset fixedpoint.Value // added by hard sigmoid after the slope, at the layer's output scale
+
+	Tabled           bool             // read from an activation table rather than computed
+	TableLo, TableHi fixedpoint.Value // inputs the table covers, at the layer's output scale
+}
+
+// needsTable reports whether the activation can only be evaluated with an activation table
+func (a Activation) needsTable() bool {
+	return a == Sigmoid || a == Tanh || a == GELU
+}
+
+// monotone reports whether the activation is non-decreasing, which interval
+// bounds rely on
+func (a Activation) monotone() bool {
+	return a != GELU
+}
+
+// oneLipschitz reports whether the quantized activation never moves its output
+// by more than its input, which the Lipschitz bound relies on. A table is
+// checked entry by entry, so rounding can't hide a steeper step.
+func (a activationFn) oneLipschitz(mode fixedpoint.Rounding) bool {
+	one := fixedpoint.NewValue(fixedpoint.Scale, fixedpoint.Scale)
+	if (a.Kind == LeakyReLU || a.Kind == HardSigmoid) && (a.Slope.IsNegative() || a.Slope.Cmp(one) > 0) {
+		return false
+	}
+	if !a.Tabled {
+		return a.Kind != GELU
+	}
+	prev := a.apply(a.TableLo, mode)
+	for x := a.TableLo.V.Int64() + 1; x <= a.TableHi.V.Int64(); x++ {
+		y := a.apply(fixedpoint.NewValue(x, a.TableLo.Scale), mode)
+		if step := y.Sub(prev).V; step.CmpAbs(big.NewInt(1)) > 0 {
+			return false
+		}
+		prev = y
+	}
+	return true
+}
+
+// checkActivation validates the activation of a dense or conv2d layer and its parameters
+func (l Layer) checkActivation() error {
+	one := big.NewRat(1, 1)
+	slope := func(allowZero bool) error {
+		if l.Cap != nil {
+			return fmt.Errorf("%s takes no cap", l.activation())
+		}
+		if l.Slope == nil {
+			return nil
+		}
+		s := l.Slope.Rat()
+		if s.Sign() < 0 || (!allowZero && s.Sign() == 0) || s.Cmp(one) > 0 {
+			return fmt.Errorf("%s slope %s has to be between 0 and 1", l.activation(), l.Slope)
+		}
+		return nil
+	}
+	switch l.activation() {
+	case ReLU, NoActivation, Sigmoid, Tanh, GELU:
+		if l.Slope != nil || l.Cap != nil {
+			return fmt.Errorf("%s takes no slope or cap", l.activation())
+		}
+	case LeakyReLU:
+		return slope(true)
+	case HardSigmoid:
+		return slope(false)
+	case ClippedReLU, HardTanh:
+		if l.Slope != nil {
+			return fmt.Errorf("%s takes no slope", l.activation())
+		}
+		if l.Cap == nil && l.activation() == ClippedReLU {
+			return fmt.Errorf("%s needs a cap", ClippedReLU)
+		}
+		if l.Cap != nil && l.Cap.Rat().Sign() <= 0 {
+			return fmt.Errorf("%s cap %s has to be positive", l.activation(), l.Cap)
+		}
+	default:
+		return fmt.Errorf("unknown activation %q, expected %q, %q, %q, %q, %q, %q, %q, %q or %q", l.activation(), ReLU, LeakyReLU, ClippedReLU, HardSigmoid, HardTanh, Sigmoid, Tanh, GELU, NoActivation)
+	}
+	return nil
+}
+
+// activationFn quantizes the layer's activation for outputs at outScale. The
+// parameters are rounded to the nearest step, like trained weights.
+func (p layerPlan) activationFn(outScale int64) activationFn {
+	l := p.Layer
+	nearest := func(d fixedpoint.Decimal, scale int64) fixedpoint.Value {
+		v, err := fixedpoint.Quantize(d, scale, fixedpoint.HalfUp)
+		if err != nil {
+			panic(err) // only Exact fails
+		}
+		return v
+	}
+	param := func(d *fixedpoint.Decimal, def string) fixedpoint.Decimal {
+		if d == nil {
+			return fixedpoint.MustDecimal(def)
+		}
+		return *d
+	}
+
+	a := activationFn{Kind: l.activation()}
+	switch a.Kind {
+	case LeakyReLU:
+		a.Slope = nearest(param(l.Slope, "0.01"), fixedpoint.Scale)
+	case ClippedReLU:
+		a.Lo, a.Hi = fixedpoint.NewValue(0, outScale), nearest(*l.Cap, outScale)
+	case HardSigmoid:
+		a.Slope = nearest(param(l.Slope, "0.2"), fixedpoint.Scale)
+		a.Offset = nearest(fixedpoint.MustDecimal("0.5"), outScale)
+		a.Lo, a.Hi = fixedpoint.NewValue(0, outScale), fixedpoint.NewValue(outScale, outScale)
+	case HardTanh:
+		a.Hi = nearest(param(l.Cap, "1"), outScale)
+		a.Lo = fixedpoint.NewValue(0, outScale).Sub(a.Hi)
+	}
+	if p.Table != nil && a.Kind != NoActivation {
+		a.Tabled = true
+		a.TableLo, a.TableHi = p.Table.domain(outScale)
+	}
+	return a
+}
+
+// apply is the host-side twin of define, rounding the slope products with mode
+func (a activationFn) apply(v fixedpoint.Value, mode fixedpoint.Rounding) fixedpoint.Value {
+	clamp := func(v fixedpoint.Value) fixedpoint.Value {
+		if v.Cmp(a.Lo) < 0 {
+			return a.Lo
+		}
+		if v.Cmp(a.Hi) > 0 {
+			return a.Hi
+		}
+		return v
+	}
+	switch a.Kind {
+	case ReLU:
+		return relu(v)
+	case LeakyReLU:
+		if v.IsNegative() {
+			return v.Mul(a.Slope).Rescale(v.Scale, mode)
+		}
+		return v
+	case ClippedReLU, HardTanh:
+		return clamp(v)
+	case HardSigmoid:
+		return clamp(v.Mul(a.Slope).Rescale(v.Scale, mode).Add(a.Offset))
+	case Sigmoid, Tanh, GELU:
+		// only used to fill tables, so float64 is accurate enough for any scale a table fits
+		x, y := v.Float(), 0.0
+		switch a.Kind {
+		case Sigmoid:
+			y = 1 / (1 + math.Exp(-x))
+		case Tanh:
+			y = math.Tanh(x)
+		case GELU:
+			y = x / 2 * (1 + math.Erf(x/math.Sqrt2))
+		}
+		return fixedpoint.NewValue(int64(math.Round(y*float64(v.Scale))), v.Scale)
+	}
+	return v
+}
+
+// define applies the activation inside the circuit with comparisons. The sign
+// tests range check their inputs, so values too large to compare make the
+// proof fail instead of being clipped. Activations that need a table are
+// evaluated by activationTables instead.
+func (a activationFn) define(fp *fixedpoint.API, v fixedpoint.Fixed, mode fixedpoint.Rounding) fixedpoint.Fixed {
+	constant := func(c fixedpoint.Value) fixedpoint.Fixed { return fixedpoint.New(c.Variable(), c.Scale) }
+	clamp := func(v fixedpoint.Fixed) fixedpoint.Fixed {
+		lo, hi := constant(a.Lo), constant(a.Hi)
+		v = fp.Select(fp.IsLess(v, lo), lo, v)
+		return fp.Select(fp.IsLess(hi, v), hi, v)
+	}
+	switch a.Kind {
+	case ReLU:
+		return fp.Select(fp.IsNegative(v), fixedpoint.New(0, v.Scale), v)
+	case LeakyReLU:
+		scaled := fp.Rescale(fp.Mul(v, constant(a.Slope)), v.Scale, mode)
+		return fp.Select(fp.IsNegative(v), scaled, v)
+	case ClippedReLU, HardTanh:
+		return clamp(v)
+	case HardSigmoid:
+		return clamp(fp.Add(fp.Rescale(fp.Mul(v, constant(a.Slope)), v.Scale, mode), constant(a.Offset)))
+	}
+	return v
+}
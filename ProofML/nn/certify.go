@@ -0,0 +1,222 @@
+package nn
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+
+	"sudokuChecker/fixedpoint"
+)
+
+// Certificate is the public statement of certification mode: every point of
+// the box [Center-Epsilon, Center+Epsilon] is classified as Label. Unlike the
+// ball, which only covers the sampled inputs, this is proven for the whole box
+// by propagating lower and upper bounds through every layer (interval bound
+// propagation). The box contains the L2 and L1 balls of the same radius.
+type Certificate struct {
+	Center  []frontend.Variable `gnark:",public"` // center of the box, at the input scale
+	Epsilon frontend.Variable   `gnark:",public"` // half the box width, at the input scale
+	Label   frontend.Variable   `gnark:",public"` // class every point of the box gets
+}
+
+// interval is a lower and upper bound on one activation
+type interval struct {
+	lo, hi fixedpoint.Value
+}
+
+// propagateBounds is the host-side twin of certify. It returns the bounds on
+// the outputs of the final layer for inputs in box, or an error if the bounds
+// leave the activation table.
+func propagateBounds(plan []layerPlan, weights [][][]fixedpoint.Value, biases [][]fixedpoint.Value, box []interval, quant QuantConfig) ([]interval, error) {
+	for layer, p := range plan {
+		next := make([]interval, p.Out.Size())
+		switch p.Type {
+		case Dense, Conv2D:
+			outScale := quant.ActivationScale.At(p.Param)
+			activation := p.activationFn(outScale)
+			for i, n := range p.neurons() {
+				lo, hi := sumBounds(weights[p.Param][n.Row], biases[p.Param][n.Row], n, box)
+				// round outwards so the bounds hold for every rescale mode
+				// and again inside the activation, which is non-decreasing
+				lo, hi = lo.Rescale(outScale, fixedpoint.Floor), hi.Rescale(outScale, fixedpoint.Ceil)
+				if !activation.Tabled {
+					next[i] = interval{lo: activation.apply(lo, fixedpoint.Floor), hi: activation.apply(hi, fixedpoint.Ceil)}
+					continue
+				}
+				// a table is filled with the rescale mode, and is non-decreasing itself
+				if lo.Cmp(activation.TableLo) < 0 || hi.Cmp(activation.TableHi) > 0 {
+					return nil, fmt.Errorf("layer %d neuron %d has bounds [%v, %v], outside the activation table", layer, i, lo.Float(), hi.Float())
+				}
+				next[i] = interval{lo: activation.apply(lo, quant.Rescale), hi: activation.apply(hi, quant.Rescale)}
+			}
+		default:
+			next = poolBounds(p, box)
+		}
+		box = next
+	}
+	return box, nil
+}
+
+// sumBounds returns the exact bounds of a neuron's weighted sum, at the bias
+// scale, for inputs in box
+func sumBounds(weights []fixedpoint.Value, bias fixedpoint.Value, n neuron, box []interval) (lo, hi fixedpoint.Value) {
+	lo, hi = bias, bias
+	for j, in := range n.Inputs {
+		if in < 0 {
+			continue
+		}
+		w := weights[j]
+		if w.IsNegative() {
+			lo, hi = lo.Add(w.Mul(box[in].hi)), hi.Add(w.Mul(box[in].lo))
+		} else {
+			lo, hi = lo.Add(w.Mul(box[in].lo)), hi.Add(w.Mul(box[in].hi))
+		}
+	}
+	return lo, hi
+}
+
+// poolBounds passes the bounds of box through a max pooling, average pooling
+// or flatten layer
+func poolBounds(p layerPlan, box []interval) []interval {
+	next := make([]interval, p.Out.Size())
+	switch p.Type {
+	case MaxPool:
+		// max is monotone, so the bounds of the max are the max of the bounds
+		for i, window := range p.windows() {
+			next[i] = box[window[0]]
+			for _, in := range window[1:] {
+				if box[in].lo.Cmp(next[i].lo) > 0 {
+					next[i].lo = box[in].lo
+				}
+				if box[in].hi.Cmp(next[i].hi) > 0 {
+					next[i].hi = box[in].hi
+				}
+			}
+		}
+	case AvgPool:
+		for i, window := range p.windows() {
+			lo, hi := box[window[0]].lo, box[window[0]].hi
+			for _, in := range window[1:] {
+				lo, hi = lo.Add(box[in].lo), hi.Add(box[in].hi)
+			}
+			n := int64(len(window))
+			lo = fixedpoint.Value{V: lo.V, Scale: lo.Scale * n}.Rescale(lo.Scale, fixedpoint.Floor)
+			hi = fixedpoint.Value{V: hi.V, Scale: hi.Scale * n}.Rescale(hi.Scale, fixedpoint.Ceil)
+			next[i] = interval{lo: lo, hi: hi}
+		}
+	case Flatten:
+		copy(next, box)
+	}
+	return next
+}
+
+func relu(v fixedpoint.Value) fixedpoint.Value {
+	if v.IsNegative() {
+		return fixedpoint.NewValue(0, v.Scale)
+	}
+	return v
+}
+
+// certify propagates the public box through the network and asserts that the
+// lower bound of Label's output is above the upper bound of every other output.
+//
+// For a weight w the smallest product over [lo, hi] is w*lo if w >= 0 and w*hi
+// otherwise. Lower bounds are rescaled with floor and upper bounds with ceil,
+// so they also bound the rounded activations of the forward pass in Define.
+func (circuit *ProveModelCircuit) certify(api frontend.API, fp *fixedpoint.API, plan []layerPlan) {
+	quant := circuit.Quant
+	inScale := int64(quant.InputScale)
+	// bounding the center, epsilon and the weights keeps the products below from wrapping around the field
+	nbBits := fixedpoint.ValueBits(api) / 2
+
+	eps := fixedpoint.New(circuit.Certify.Epsilon, inScale)
+	fp.AssertSignedBits(eps, nbBits)
+	api.AssertIsEqual(fp.IsNegative(eps), 0)
+
+	lo := make([]fixedpoint.Fixed, len(circuit.Certify.Center))
+	hi := make([]fixedpoint.Fixed, len(circuit.Certify.Center))
+	for i := range circuit.Certify.Center {
+		center := fixedpoint.New(circuit.Certify.Center[i], inScale)
+		fp.AssertSignedBits(center, nbBits)
+		lo[i], hi[i] = fp.Sub(center, eps), fp.Add(center, eps)
+	}
+
+	for _, p := range plan {
+		newLo := make([]fixedpoint.Fixed, p.Out.Size())
+		newHi := make([]fixedpoint.Fixed, p.Out.Size())
+
+		switch p.Type {
+		case Dense, Conv2D:
+			weightScale, outScale := quant.WeightScale.At(p.Param), quant.ActivationScale.At(p.Param)
+			activation := p.activationFn(outScale)
+
+			// a convolution uses every weight many times, decide the signs once
+			isNeg := make([][]frontend.Variable, len(circuit.Weights[p.Param]))
+			for row := range circuit.Weights[p.Param] {
+				isNeg[row] = make([]frontend.Variable, p.FanIn)
+				for j := range circuit.Weights[p.Param][row] {
+					weight := fixedpoint.New(circuit.Weights[p.Param][row][j], weightScale)
+					fp.AssertSignedBits(weight, nbBits)
+					isNeg[row][j] = fp.IsNegative(weight)
+				}
+			}
+
+			for i, n := range p.neurons() {
+				sumLo := fixedpoint.New(circuit.Biases[p.Param][n.Row], quant.BiasScale(p.Param))
+				sumHi := sumLo
+				for j, in := range n.Inputs {
+					if in < 0 {
+						continue
+					}
+					weight := fixedpoint.New(circuit.Weights[p.Param][n.Row][j], weightScale)
+					atLo, atHi := fp.Mul(weight, lo[in]), fp.Mul(weight, hi[in])
+					sumLo = fp.Add(sumLo, fp.Select(isNeg[n.Row][j], atHi, atLo))
+					sumHi = fp.Add(sumHi, fp.Select(isNeg[n.Row][j], atLo, atHi))
+				}
+				l := fp.Rescale(sumLo, outScale, fixedpoint.Floor)
+				u := fp.Rescale(sumHi, outScale, fixedpoint.Ceil)
+				if activation.Tabled {
+					newLo[i] = circuit.activate(api, fp, activation, l, quant.Rescale)
+					newHi[i] = circuit.activate(api, fp, activation, u, quant.Rescale)
+				} else {
+					newLo[i] = activation.define(fp, l, fixedpoint.Floor)
+					newHi[i] = activation.define(fp, u, fixedpoint.Ceil)
+				}
+			}
+		case MaxPool:
+			for i, window := range p.windows() {
+				newLo[i], newHi[i] = lo[window[0]], hi[window[0]]
+				for _, in := range window[1:] {
+					newLo[i] = fp.Select(fp.IsLess(newLo[i], lo[in]), lo[in], newLo[i])
+					newHi[i] = fp.Select(fp.IsLess(newHi[i], hi[in]), hi[in], newHi[i])
+				}
+			}
+		case AvgPool:
+			for i, window := range p.windows() {
+				newLo[i] = average(fp, lo, window, fixedpoint.Floor)
+				newHi[i] = average(fp, hi, window, fixedpoint.Ceil)
+			}
+		case Flatten:
+			copy(newLo, lo)
+			copy(newHi, hi)
+		}
+		lo, hi = newLo, newHi
+	}
+
+	// pick the label's lower bound, the label must be one of the classes
+	isLabel := make([]frontend.Variable, len(lo))
+	labelLo := frontend.Variable(0)
+	nbMatches := frontend.Variable(0)
+	for i := range lo {
+		isLabel[i] = api.IsZero(api.Sub(circuit.Certify.Label, i))
+		labelLo = api.Add(labelLo, api.Mul(isLabel[i], lo[i].V))
+		nbMatches = api.Add(nbMatches, isLabel[i])
+	}
+	api.AssertIsEqual(nbMatches, 1)
+
+	labelBound := fixedpoint.New(labelLo, lo[0].Scale)
+	for i := range hi {
+		beaten := fp.IsLess(hi[i], labelBound)
+		api.AssertIsEqual(api.Select(isLabel[i], 1, beaten), 1)
+	}
+}
@@ -0,0 +1,552 @@
+// Package nn is the neural-network prover: the circuit proving that a
+// committed, quantized model classifies public inputs as claimed, together
+// with the model files it reads, the host-side twin of its arithmetic and the
+// analyses run before proving.
+package nn
+
+import (
+	"fmt"
+	"math/big"
+
+	"sudokuChecker/fixedpoint"
+
+	"github.com/consensys/gnark/frontend"
+)
+
+// ProveModelCircuit defines the circuit structure for the neural network
+type ProveModelCircuit struct {
+	Tag      frontend.Variable       `gnark:",public"`  // CircuitTag of the shape and quantization, so the witness names the circuit
+	Weights  [][][]frontend.Variable `gnark:",private"` // Weights as 3D slices
+	Biases   [][]frontend.Variable   `gnark:",private"` // Biases as 2D slices
+	Inputs   [][]frontend.Variable   `gnark:",public"`  // Input vectors as a 2D slice
+	Expected []frontend.Variable     `gnark:",private"` // Expected outputs as a 1D slice
+
+	Commitment frontend.Variable `gnark:",public"` // MiMC hash of the architecture, Weights and Biases, see ModelDigest
+
+	Ball         *RobustnessBall // nil unless the inputs are checked against a ball
+	Certify      *Certificate    // nil unless a box is certified
+	SameLabel    *SameLabel      // nil unless all inputs and the ball center share a public label
+	Margin       *LogitMargin    // nil unless the inputs have to win by a public margin
+	MarginReport *MarginReport   // nil unless the smallest margin is published
+
+	Shape ModelShape  `gnark:"-"` // layers the weights belong to
+	Quant QuantConfig `gnark:"-"` // scales and rounding the values above were quantized with
+
+	tables *activationTables // built while compiling when the model has an activation table
+}
+
+// NewProveModelCircuit allocates a circuit whose slices match the given shape.
+// gnark needs the slices sized before compiling, so both the circuit definition
+// and the assignment are created through here. The quantization config is
+// compiled into the circuit, so it has to be the one the files were scaled with.
+// The shape must come from CircuitShape or ModelData.Shape, which check its layers.
+func NewProveModelCircuit(shape ModelShape, quant QuantConfig) *ProveModelCircuit {
+	plan, err := shape.plan()
+	if err != nil {
+		panic(fmt.Sprintf("NewProveModelCircuit: %v", err))
+	}
+	circuit := &ProveModelCircuit{
+		Shape:    shape,
+		Quant:    quant,
+		Tag:      CircuitTag("model", shape, quant),
+		Weights:  make([][][]frontend.Variable, len(shape.LayerSizes)),
+		Biases:   make([][]frontend.Variable, len(shape.LayerSizes)),
+		Inputs:   make([][]frontend.Variable, shape.BatchSize),
+		Expected: make([]frontend.Variable, shape.BatchSize),
+	}
+	for _, p := range plan {
+		if p.Param < 0 {
+			continue
+		}
+		neurons := shape.LayerSizes[p.Param]
+		circuit.Weights[p.Param] = make([][]frontend.Variable, neurons)
+		for i := range circuit.Weights[p.Param] {
+			circuit.Weights[p.Param][i] = make([]frontend.Variable, p.FanIn)
+		}
+		circuit.Biases[p.Param] = make([]frontend.Variable, neurons)
+	}
+	for k := range circuit.Inputs {
+		circuit.Inputs[k] = make([]frontend.Variable, shape.InputSize)
+	}
+	if shape.Ball != "" {
+		circuit.Ball = &RobustnessBall{Center: make([]frontend.Variable, shape.InputSize), Norm: shape.Ball}
+	}
+	if shape.Certify {
+		circuit.Certify = &Certificate{Center: make([]frontend.Variable, shape.InputSize)}
+	}
+	if shape.SameLabel {
+		circuit.SameLabel = &SameLabel{}
+	}
+	if shape.Margin {
+		circuit.Margin = &LogitMargin{}
+	}
+	if shape.ReportMargin {
+		circuit.MarginReport = &MarginReport{}
+	}
+	return circuit
+}
+
+// NewAssignment fills a circuit of the given shape with the model, inputs,
+// expected outputs, ball and box, quantized with the model's scales and
+// rounding mode. It fails if a value can't be represented at its scale under
+// that rounding mode, if an input lies outside the ball, or if the box can't
+// be certified.
+func NewAssignment(shape ModelShape, d *ProverData) (*ProveModelCircuit, error) {
+	m, in, exp := d.Model, d.Inputs, d.Expected
+	quant := m.Quant()
+	assignment := NewProveModelCircuit(shape, quant)
+
+	plan, err := shape.plan()
+	if err != nil {
+		return nil, err
+	}
+	weights, biases, err := m.Quantize()
+	if err != nil {
+		return nil, err
+	}
+	for layer := range weights {
+		for neuron := range weights[layer] {
+			for j := range weights[layer][neuron] {
+				assignment.Weights[layer][neuron][j] = weights[layer][neuron][j].Variable()
+			}
+			assignment.Biases[layer][neuron] = biases[layer][neuron].Variable()
+		}
+	}
+	assignment.Commitment = ModelDigest(shape, quant, weights, biases)
+
+	inputs := make([][]fixedpoint.Value, len(in.Inputs))
+	for i := range in.Inputs {
+		inputs[i] = make([]fixedpoint.Value, len(in.Inputs[i]))
+		for j := range in.Inputs[i] {
+			scaledInput, err := fixedpoint.Quantize(in.Inputs[i][j], int64(quant.InputScale), quant.Rounding)
+			if err != nil {
+				return nil, fmt.Errorf("value %d of input %d: %w", j, i, err)
+			}
+			inputs[i][j] = scaledInput
+			assignment.Inputs[i][j] = scaledInput.Variable()
+		}
+		if err := checkTableDomain(plan, traceForward(plan, weights, biases, inputs[i], quant), quant); err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+
+	if shape.Ball != "" {
+		center := make([]fixedpoint.Value, len(d.Ball.Center))
+		for j := range d.Ball.Center {
+			scaledCenter, err := fixedpoint.Quantize(d.Ball.Center[j], int64(quant.InputScale), quant.Rounding)
+			if err != nil {
+				return nil, fmt.Errorf("value %d of the ball center: %w", j, err)
+			}
+			center[j] = scaledCenter
+			assignment.Ball.Center[j] = scaledCenter.Variable()
+		}
+		// rounded down, so the proven ball is never larger than the one stated
+		radius, err := fixedpoint.Quantize(d.Ball.Radius, int64(quant.InputScale), fixedpoint.Floor)
+		if err != nil {
+			return nil, fmt.Errorf("ball radius: %w", err)
+		}
+		assignment.Ball.Radius = radius.Variable()
+
+		// catch points outside the ball here rather than as an unsatisfied constraint
+		for i := range inputs {
+			if ballDistance(shape.Ball, inputs[i], center).Cmp(ballBound(shape.Ball, radius)) > 0 {
+				return nil, fmt.Errorf("input %d lies outside the %s ball of radius %s", i, shape.Ball, d.Ball.Radius)
+			}
+		}
+
+		if shape.SameLabel {
+			label := exp.Expected[0]
+			assignment.SameLabel.Label = label
+			if err := checkTableDomain(plan, traceForward(plan, weights, biases, center, quant), quant); err != nil {
+				return nil, fmt.Errorf("ball center: %w", err)
+			}
+			if got := predict(plan, weights, biases, center, quant); got != label {
+				return nil, fmt.Errorf("the ball center is classified as %d, not as the label %d", got, label)
+			}
+		}
+	}
+
+	if shape.Certify {
+		// rounded up, so the certified box is never smaller than the one stated
+		eps, err := fixedpoint.Quantize(d.Certify.Epsilon, int64(quant.InputScale), fixedpoint.Ceil)
+		if err != nil {
+			return nil, fmt.Errorf("certified epsilon: %w", err)
+		}
+		assignment.Certify.Epsilon = eps.Variable()
+		assignment.Certify.Label = d.Certify.Label
+
+		box := make([]interval, len(d.Certify.Center))
+		for j := range d.Certify.Center {
+			scaledCenter, err := fixedpoint.Quantize(d.Certify.Center[j], int64(quant.InputScale), quant.Rounding)
+			if err != nil {
+				return nil, fmt.Errorf("value %d of the certified center: %w", j, err)
+			}
+			box[j] = interval{lo: scaledCenter.Sub(eps), hi: scaledCenter.Add(eps)}
+			assignment.Certify.Center[j] = scaledCenter.Variable()
+		}
+
+		// catch boxes the bounds can't certify here rather than as an unsatisfied constraint
+		bounds, err := propagateBounds(plan, weights, biases, box, quant)
+		if err != nil {
+			return nil, fmt.Errorf("certifying the box: %w", err)
+		}
+		label := d.Certify.Label
+		for i := range bounds {
+			if i != label && bounds[i].hi.Cmp(bounds[label].lo) >= 0 {
+				return nil, fmt.Errorf("can't certify class %d: its lower bound %v doesn't beat the upper bound %v of class %d",
+					label, bounds[label].lo.Float(), bounds[i].hi.Float(), i)
+			}
+		}
+	}
+
+	if shape.Margin || shape.ReportMargin {
+		lastScale := quant.ActivationScale.At(len(weights) - 1)
+		var smallest fixedpoint.Value
+		for i := range inputs {
+			m := margin(forwardValues(plan, weights, biases, inputs[i], quant))
+			if i == 0 || m.Cmp(smallest) < 0 {
+				smallest = m
+			}
+		}
+		if shape.Margin {
+			// rounded up, so the proven margin is never below the one asked for
+			delta, err := fixedpoint.Quantize(*d.Margin, lastScale, fixedpoint.Ceil)
+			if err != nil {
+				return nil, fmt.Errorf("margin: %w", err)
+			}
+			if smallest.Cmp(delta) < 0 {
+				return nil, fmt.Errorf("an input only wins by %s, less than the margin %s", smallest.Decimal(), d.Margin)
+			}
+			assignment.Margin.Delta = delta.Variable()
+		}
+		if shape.ReportMargin {
+			assignment.MarginReport.Smallest = smallest.Variable()
+		}
+	}
+
+	for i := range exp.Expected {
+		assignment.Expected[i] = exp.Expected[i]
+	}
+	return assignment, nil
+}
+
+func (circuit *ProveModelCircuit) Define(api frontend.API) error {
+	fp := fixedpoint.NewAPI(api)
+	quant := circuit.Quant
+
+	plan, err := circuit.Shape.plan()
+	if err != nil {
+		return err
+	}
+	circuit.tables = nil
+
+	api.AssertIsEqual(circuit.Tag, CircuitTag("model", circuit.Shape, quant))
+	if err := assertCommitment(api, circuit.Shape, circuit.Quant, circuit.Weights, circuit.Biases, circuit.Commitment); err != nil {
+		return err
+	}
+
+	var bound fixedpoint.Fixed
+	if circuit.Ball != nil {
+		bound = circuit.radiusBound(api, fp)
+	}
+
+	if circuit.Certify != nil {
+		circuit.certify(api, fp, plan)
+	}
+
+	if circuit.SameLabel != nil {
+		// the unperturbed center has to get the label as well
+		center := make([]fixedpoint.Fixed, len(circuit.Ball.Center))
+		for i := range circuit.Ball.Center {
+			center[i] = fixedpoint.New(circuit.Ball.Center[i], int64(quant.InputScale))
+			fp.AssertSignedBits(center[i], fixedpoint.ValueBits(api)/2)
+		}
+		api.AssertIsEqual(argmax(api, fp, circuit.forward(api, fp, plan, center)), circuit.SameLabel.Label)
+	}
+
+	var delta, smallest fixedpoint.Fixed
+	lastScale := quant.ActivationScale.At(len(circuit.Weights) - 1)
+	if circuit.Margin != nil {
+		delta = fixedpoint.New(circuit.Margin.Delta, lastScale)
+		api.AssertIsEqual(fp.IsNegative(delta), 0)
+	}
+
+	// Iterate over each input vector
+	for k := 0; k < len(circuit.Inputs); k++ {
+		// Start with the input vector
+		layerOutputs := make([]fixedpoint.Fixed, len(circuit.Inputs[k]))
+		for i := range circuit.Inputs[k] {
+			layerOutputs[i] = fixedpoint.New(circuit.Inputs[k][i], int64(quant.InputScale))
+		}
+		if circuit.Ball != nil {
+			circuit.assertInBall(api, fp, layerOutputs, bound)
+		}
+
+		var maxIdx frontend.Variable
+		if circuit.Margin == nil && circuit.MarginReport == nil {
+			maxIdx = argmax(api, fp, circuit.forward(api, fp, plan, layerOutputs))
+		} else {
+			var margin fixedpoint.Fixed
+			maxIdx, margin = argmaxMargin(api, fp, circuit.forward(api, fp, plan, layerOutputs))
+			if circuit.Margin != nil {
+				api.AssertIsEqual(fp.IsLess(margin, delta), 0)
+			}
+			if k == 0 {
+				smallest = margin
+			} else {
+				smallest = fp.Select(fp.IsLess(margin, smallest), margin, smallest)
+			}
+		}
+
+		// Assert the predicted output matches the expected output
+		api.AssertIsEqual(maxIdx, circuit.Expected[k])
+		if circuit.SameLabel != nil {
+			api.AssertIsEqual(circuit.Expected[k], circuit.SameLabel.Label)
+		}
+	}
+
+	if circuit.MarginReport != nil {
+		api.AssertIsEqual(smallest.V, circuit.MarginReport.Smallest)
+	}
+
+	return nil
+}
+
+// forward runs the network on one input vector and returns the final layer's outputs
+func (circuit *ProveModelCircuit) forward(api frontend.API, fp *fixedpoint.API, plan []layerPlan, layerOutputs []fixedpoint.Fixed) []fixedpoint.Fixed {
+	quant := circuit.Quant
+
+	// Iterate over each layer
+	for _, p := range plan {
+		// Create a new slice for the outputs
+		newOutputs := make([]fixedpoint.Fixed, p.Out.Size())
+
+		switch p.Type {
+		case Dense, Conv2D:
+			weightScale, outScale := quant.WeightScale.At(p.Param), quant.ActivationScale.At(p.Param)
+			activation := p.activationFn(outScale)
+
+			// Iterate over each neuron in the layer, a convolution has one per output channel and position
+			for i, n := range p.neurons() {
+				sum := fixedpoint.New(circuit.Biases[p.Param][n.Row], quant.BiasScale(p.Param))
+
+				// Compute the weighted sum, padding contributes nothing
+				for j, in := range n.Inputs {
+					if in < 0 {
+						continue
+					}
+					weight := fixedpoint.New(circuit.Weights[p.Param][n.Row][j], weightScale)
+					sum = fp.Add(sum, fp.Mul(weight, layerOutputs[in]))
+				}
+
+				// Scale the sum back down to the activation scale
+				sum = fp.Rescale(sum, outScale, quant.Rescale)
+				// Apply the layer's activation
+				newOutputs[i] = circuit.activate(api, fp, activation, sum, quant.Rescale)
+			}
+		case MaxPool:
+			for i, window := range p.windows() {
+				maxVal := layerOutputs[window[0]]
+				for _, in := range window[1:] {
+					maxVal = fp.Select(fp.IsLess(maxVal, layerOutputs[in]), layerOutputs[in], maxVal)
+				}
+				newOutputs[i] = maxVal
+			}
+		case AvgPool:
+			for i, window := range p.windows() {
+				newOutputs[i] = average(fp, layerOutputs, window, quant.Rescale)
+			}
+		case Flatten:
+			copy(newOutputs, layerOutputs)
+		}
+
+		// The next layer reads this layer's outputs, which may be a different width
+		layerOutputs = newOutputs
+	}
+	return layerOutputs
+}
+
+// average returns the mean of the values in window. Dividing the sum by the
+// window size is a rescale from a scale that many times finer, so it is
+// rounded the same way as the layers.
+func average(fp *fixedpoint.API, values []fixedpoint.Fixed, window []int, mode fixedpoint.Rounding) fixedpoint.Fixed {
+	sum := values[window[0]]
+	for _, in := range window[1:] {
+		sum = fp.Add(sum, values[in])
+	}
+	scale := sum.Scale
+	return fp.Rescale(fixedpoint.New(sum.V, scale*int64(len(window))), scale, mode)
+}
+
+// argmax returns the index of the largest output, the first one on ties
+func argmax(api frontend.API, fp *fixedpoint.API, outputs []fixedpoint.Fixed) frontend.Variable {
+	maxVal := outputs[0]
+	maxIdx := frontend.Variable(0)
+	for i := 1; i < len(outputs); i++ {
+		isLess := fp.IsLess(maxVal, outputs[i])
+		maxVal = fp.Select(isLess, outputs[i], maxVal)
+		maxIdx = api.Select(isLess, frontend.Variable(i), maxIdx)
+	}
+	return maxIdx
+}
+
+// ProofMetadata is written next to the proof. The quantization is compiled
+// into the circuit, so a verifier needs it to rebuild the public inputs. The
+// public CircuitTag makes a proof fail against metadata claiming another shape
+// or quantization than its key was set up for.
+type ProofMetadata struct {
+	Shape          ModelShape          `json:"shape"`
+	Quantization   QuantConfig         `json:"quantization"`
+	Commitment     string              `json:"commitment"`      // ModelDigest of the proven model
+	Setup          string              `json:"setup,omitempty"` // SetupID of the keys, see proofsystem.CheckSetup
+	Ball           *BallData           `json:"ball,omitempty"`
+	Certify        *CertifyData        `json:"certify,omitempty"`
+	Label          *int                `json:"label,omitempty"`          // class every input and the ball center get, with the same-label statement
+	Margin         *fixedpoint.Decimal `json:"margin,omitempty"`         // margin every input wins by
+	SmallestMargin *fixedpoint.Decimal `json:"smallestMargin,omitempty"` // the published smallest margin
+}
+
+// NewProofMetadata returns the metadata of a proof of assignment, made from d
+func NewProofMetadata(shape ModelShape, d *ProverData, assignment *ProveModelCircuit) ProofMetadata {
+	quant := d.Model.Quant()
+	meta := ProofMetadata{
+		Shape:        shape,
+		Quantization: quant,
+		Commitment:   fmt.Sprint(assignment.Commitment),
+		Ball:         d.Ball,
+		Certify:      d.Certify,
+		Margin:       d.Margin,
+	}
+	if shape.SameLabel {
+		meta.Label = &d.Expected.Expected[0]
+	}
+	if assignment.MarginReport != nil {
+		lastScale := quant.ActivationScale.At(len(shape.LayerSizes) - 1)
+		smallest := fixedpoint.Value{V: assignment.MarginReport.Smallest.(*big.Int), Scale: lastScale}.Decimal()
+		meta.SmallestMargin = &smallest
+	}
+	return meta
+}
+
+// LoadMetadata reads the metadata written next to a proof
+func LoadMetadata(path string) (*ProofMetadata, error) {
+	var meta ProofMetadata
+	if err := readJSON(path, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// Check returns an error if the statements the shape proves and the values
+// the metadata holds for them disagree, either way
+func (meta *ProofMetadata) Check() error {
+	s := meta.Shape
+	for _, c := range []struct {
+		proven, present   bool
+		statement, values string
+	}{
+		{s.Ball != "", meta.Ball != nil, "checks a ball", "a ball"},
+		{s.SameLabel, meta.Label != nil, "publishes a label", "a label"},
+		{s.Certify, meta.Certify != nil, "certifies a box", "a certified box"},
+		{s.Margin, meta.Margin != nil, "has a margin", "a margin"},
+		{s.ReportMargin, meta.SmallestMargin != nil, "publishes its smallest margin", "a smallest margin"},
+	} {
+		if c.proven && !c.present {
+			return fmt.Errorf("the proof %s but the metadata has none", c.statement)
+		}
+		if !c.proven && c.present {
+			return fmt.Errorf("the metadata has %s but the proof doesn't use one", c.values)
+		}
+	}
+	return nil
+}
+
+// PublicAssignment rebuilds the public part of the assignment a proof was
+// made with from its metadata and inputs, for a verifier to turn into a
+// public-only witness. Values are quantized exactly as NewAssignment does.
+func PublicAssignment(meta *ProofMetadata, in *InputData) (*ProveModelCircuit, error) {
+	shape, quant := meta.Shape, meta.Quantization
+	if _, err := shape.plan(); err != nil {
+		return nil, err
+	}
+	if err := quant.Validate(len(shape.LayerSizes)); err != nil {
+		return nil, err
+	}
+	if err := meta.Check(); err != nil {
+		return nil, err
+	}
+	if len(in.Inputs) != shape.BatchSize {
+		return nil, fmt.Errorf("got %d inputs but the proof is for %d", len(in.Inputs), shape.BatchSize)
+	}
+	assignment := NewProveModelCircuit(shape, quant)
+
+	scale := int64(quant.InputScale)
+	quantize := func(values []fixedpoint.Decimal, dst []frontend.Variable, what string) error {
+		if len(values) != shape.InputSize {
+			return fmt.Errorf("%s has %d values but the model expects %d", what, len(values), shape.InputSize)
+		}
+		for j := range values {
+			v, err := fixedpoint.Quantize(values[j], scale, quant.Rounding)
+			if err != nil {
+				return fmt.Errorf("value %d of %s: %w", j, what, err)
+			}
+			dst[j] = v.Variable()
+		}
+		return nil
+	}
+	for i := range in.Inputs {
+		if err := quantize(in.Inputs[i], assignment.Inputs[i], fmt.Sprintf("input %d", i)); err != nil {
+			return nil, err
+		}
+	}
+	commitment, ok := new(big.Int).SetString(meta.Commitment, 10)
+	if !ok {
+		return nil, fmt.Errorf("commitment %q is not a number", meta.Commitment)
+	}
+	assignment.Commitment = commitment
+
+	if shape.Ball != "" {
+		if err := quantize(meta.Ball.Center, assignment.Ball.Center, "the ball center"); err != nil {
+			return nil, err
+		}
+		// rounded down like the prover does
+		radius, err := fixedpoint.Quantize(meta.Ball.Radius, scale, fixedpoint.Floor)
+		if err != nil {
+			return nil, fmt.Errorf("ball radius: %w", err)
+		}
+		assignment.Ball.Radius = radius.Variable()
+	}
+	if shape.SameLabel {
+		assignment.SameLabel.Label = *meta.Label
+	}
+	if shape.Certify {
+		if err := quantize(meta.Certify.Center, assignment.Certify.Center, "the certified center"); err != nil {
+			return nil, err
+		}
+		// rounded up like the prover does
+		eps, err := fixedpoint.Quantize(meta.Certify.Epsilon, scale, fixedpoint.Ceil)
+		if err != nil {
+			return nil, fmt.Errorf("certified epsilon: %w", err)
+		}
+		assignment.Certify.Epsilon = eps.Variable()
+		assignment.Certify.Label = meta.Certify.Label
+	}
+
+	lastScale := quant.ActivationScale.At(len(shape.LayerSizes) - 1)
+	if shape.Margin {
+		// rounded up like the prover does
+		delta, err := fixedpoint.Quantize(*meta.Margin, lastScale, fixedpoint.Ceil)
+		if err != nil {
+			return nil, fmt.Errorf("margin: %w", err)
+		}
+		assignment.Margin.Delta = delta.Variable()
+	}
+	if shape.ReportMargin {
+		smallest, err := fixedpoint.Quantize(*meta.SmallestMargin, lastScale, fixedpoint.Exact)
+		if err != nil {
+			return nil, fmt.Errorf("smallest margin: %w", err)
+		}
+		assignment.MarginReport.Smallest = smallest.Variable()
+	}
+	return assignment, nil
+}
@@ -0,0 +1,572 @@
+package nn
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/constraint/solver"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/test"
+
+	"sudokuChecker/fixedpoint"
+)
+
+// testProverData returns weightsGood.json and the first point of inputs.json
+func testProverData(assert *test.Assert) *ProverData {
+	var m ModelData
+	assert.NoError(json.Unmarshal([]byte(`{
+		"weights": [
+			[[0.1, 0.75, 0.06], [0.77, -0.03, 0.32], [-0.91, 0.91, -0.03]],
+			[[0.1, -0.66, -0.69], [-0.97, 0.49, -0.38], [0.01, 0.21, -0.53]]
+		],
+		"biases": [[-0.13, 0.21, 0.83], [0.34, -0.28, 0.69]]
+	}`), &m))
+	return &ProverData{
+		Model: &m,
+		Inputs: &InputData{Inputs: [][]fixedpoint.Decimal{{
+			fixedpoint.MustDecimal("-0.22"), fixedpoint.MustDecimal("0.03"), fixedpoint.MustDecimal("0.18"),
+		}}},
+		Expected: &ExpectedData{Expected: []int{2}},
+	}
+}
+
+// solve compiles the model circuit for data and checks that it accepts the
+// assignment of data, changed by every tamper. It returns the error of the
+// first step that refuses: the shape, the host's assignment or the circuit.
+func solve(assert *test.Assert, data *ProverData, tamper ...func(*ProveModelCircuit)) error {
+	shape, err := CircuitShape(data)
+	if err != nil {
+		return err
+	}
+	field := ecc.BN254.ScalarField()
+	ccs, err := frontend.Compile(field, r1cs.NewBuilder, NewProveModelCircuit(shape, data.Model.Quant()))
+	assert.NoError(err)
+	assignment, err := NewAssignment(shape, data)
+	if err != nil {
+		return err
+	}
+	for _, f := range tamper {
+		f(assignment)
+	}
+	witness, err := frontend.NewWitness(assignment, field)
+	assert.NoError(err)
+	return ccs.IsSolved(witness)
+}
+
+func TestProveModelTamperedHint(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	data := testProverData(assert)
+	shape, err := CircuitShape(data)
+	assert.NoError(err)
+
+	field := ecc.BN254.ScalarField()
+	ccs, err := frontend.Compile(field, r1cs.NewBuilder, NewProveModelCircuit(shape, data.Model.Quant()))
+	assert.NoError(err)
+	assignment, err := NewAssignment(shape, data)
+	assert.NoError(err)
+	witness, err := frontend.NewWitness(assignment, field)
+	assert.NoError(err)
+
+	assert.NoError(ccs.IsSolved(witness))
+
+	// shift every activation by one unit while keeping a == quo*r + rem
+	smallModHint := fixedpoint.GetHints()[0]
+	tampered := func(mod *big.Int, inputs []*big.Int, outputs []*big.Int) error {
+		if err := smallModHint(mod, inputs, outputs); err != nil {
+			return err
+		}
+		outputs[1].Add(outputs[1], big.NewInt(1))
+		outputs[0].Sub(outputs[0], inputs[1]).Mod(outputs[0], mod)
+		return nil
+	}
+	err = ccs.IsSolved(witness, solver.OverrideHint(solver.GetHintID(smallModHint), tampered))
+	assert.Error(err)
+}
+
+func TestNewAssignmentRejectsInexactValues(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	var m ModelData
+	assert.NoError(json.Unmarshal([]byte(`{"weights": [[[0.1, 0.2915]]], "biases": [[0.5]]}`), &m))
+	in := &InputData{Inputs: [][]fixedpoint.Decimal{{fixedpoint.MustDecimal("1"), fixedpoint.MustDecimal("2")}}}
+	exp := &ExpectedData{Expected: []int{0}}
+
+	shape, err := CircuitShape(&ProverData{Model: &m, Inputs: in, Expected: exp})
+	assert.NoError(err)
+
+	// 0.2915 needs a fourth decimal at scale 1000
+	_, err = NewAssignment(shape, &ProverData{Model: &m, Inputs: in, Expected: exp})
+	assert.Error(err)
+
+	// unless the model asks for rounding
+	quant := DefaultQuantConfig()
+	quant.Rounding = fixedpoint.HalfUp
+	m.Quantization = &quant
+	_, err = NewAssignment(shape, &ProverData{Model: &m, Inputs: in, Expected: exp})
+	assert.NoError(err)
+}
+
+// TestStatements proves every statement of the shape on weightsGood.json, then
+// checks that the host refuses a false claim and the circuit a witness tampered
+// to make one
+func TestStatements(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	// initialPoint.json, the input differs from the center by (-0.09, -0.03, 0.02)
+	center := []fixedpoint.Decimal{fixedpoint.MustDecimal("-0.13"), fixedpoint.MustDecimal("0.06"), fixedpoint.MustDecimal("0.16")}
+	ball := func(norm Norm, radius string) func(*ProverData) {
+		return func(data *ProverData) {
+			data.Ball = &BallData{Center: center, Radius: fixedpoint.MustDecimal(radius), Norm: norm}
+		}
+	}
+	type tamper struct {
+		what  string
+		apply func(*ProveModelCircuit)
+		holds bool // whether the circuit still accepts the witness
+	}
+	rounding := func(mode fixedpoint.Rounding, setup func(*ProverData)) func(*ProverData) {
+		return func(data *ProverData) {
+			quant := DefaultQuantConfig()
+			quant.Rounding = mode
+			data.Model.Quantization = &quant
+			setup(data)
+		}
+	}
+	radius := func(raw int) []tamper {
+		return []tamper{{"a radius that excludes the input", func(a *ProveModelCircuit) { a.Ball.Radius = raw }, false}}
+	}
+	cases := []struct {
+		name    string
+		setup   func(*ProverData)
+		refuse  func(*ProverData) // makes the claim false, or the statement impossible, if any
+		tampers []tamper
+	}{
+		// the radius just includes the input, a smaller one excludes it
+		{"l2 ball", ball(L2, "0.1"), ball(L2, "0.09"), radius(90)}, // distance 0.097
+		{"linf ball", ball(LInf, "0.09"), ball(LInf, "0.089"), radius(89)},
+		{"l1 ball", ball(L1, "0.14"), ball(L1, "0.139"), radius(139)},
+		// the radius is rounded down whatever the model's rounding, half up would
+		// prove a ball of 0.09 for a stated 0.0899
+		{"half-up linf ball", rounding(fixedpoint.HalfUp, ball(LInf, "0.09")), rounding(fixedpoint.HalfUp, ball(LInf, "0.0899")), nil},
+		{
+			name: "certified box",
+			setup: func(data *ProverData) {
+				data.Certify = &CertifyData{Center: center, Epsilon: fixedpoint.MustDecimal("0.15"), Label: 2}
+			},
+			// the bounds of a wider box overlap
+			refuse: func(data *ProverData) { data.Certify.Epsilon = fixedpoint.MustDecimal("0.2") },
+			tampers: []tamper{
+				{"a wider box", func(a *ProveModelCircuit) { a.Certify.Epsilon = 200 }, false},
+				{"another label for the center alone", func(a *ProveModelCircuit) { a.Certify.Epsilon, a.Certify.Label = 0, 0 }, false},
+			},
+		},
+		{
+			// epsilon is rounded up whatever the model's rounding, floor would
+			// certify a box of 0.163 for a stated 0.1631
+			name: "floored certified box",
+			setup: rounding(fixedpoint.Floor, func(data *ProverData) {
+				data.Certify = &CertifyData{Center: center, Epsilon: fixedpoint.MustDecimal("0.163"), Label: 2}
+			}),
+			refuse: func(data *ProverData) { data.Certify.Epsilon = fixedpoint.MustDecimal("0.1631") },
+		},
+		{
+			name:  "commitment",
+			setup: func(*ProverData) {},
+			tampers: []tamper{
+				// the host digest, with negative weights and biases, matches the
+				// circuit's hash, so a different model that still classifies the
+				// input the same way is rejected
+				{"another model", func(a *ProveModelCircuit) { a.Weights[1][2][0] = 11 }, false}, // 0.011 instead of 0.01
+				{"another model with its commitment", func(a *ProveModelCircuit) {
+					a.Weights[1][2][0] = 11
+					m := testProverData(assert).Model
+					m.Weights[1][2][0] = fixedpoint.MustDecimal("0.011")
+					weights, biases, err := m.Quantize()
+					assert.NoError(err)
+					a.Commitment = ModelDigest(a.Shape, a.Quant, weights, biases)
+				}, true},
+			},
+		},
+		{
+			name: "same label",
+			setup: func(data *ProverData) {
+				ball(L2, "0.1")(data)
+				data.SameLabel = true
+			},
+			// a ball is required
+			refuse: func(data *ProverData) { data.Ball = nil },
+			tampers: []tamper{
+				{"another public label, with matching private outputs", func(a *ProveModelCircuit) {
+					a.SameLabel.Label = 1
+					a.Expected[0] = 1
+				}, false},
+				// the center (-0.5, 0.5, 0) is classified as 0
+				{"a center of another class", func(a *ProveModelCircuit) {
+					a.Ball.Center = []frontend.Variable{-500, 500, 0}
+					a.Ball.Radius = 1000
+				}, false},
+			},
+		},
+		{
+			name: "margin",
+			// the inputs win by 0.152 and 0.189
+			setup: func(data *ProverData) {
+				data.Inputs.Inputs = append(data.Inputs.Inputs, []fixedpoint.Decimal{
+					fixedpoint.MustDecimal("-0.1"), fixedpoint.MustDecimal("0.1"), fixedpoint.MustDecimal("0.1"),
+				})
+				data.Expected.Expected = append(data.Expected.Expected, 2)
+				delta := fixedpoint.MustDecimal("0.152")
+				data.Margin, data.ReportMargin = &delta, true
+			},
+			refuse: func(data *ProverData) { *data.Margin = fixedpoint.MustDecimal("0.1521") },
+			tampers: []tamper{
+				{"the smallest margin", func(a *ProveModelCircuit) { a.MarginReport.Smallest = 152 }, true},
+				{"a larger smallest margin", func(a *ProveModelCircuit) { a.MarginReport.Smallest = 189 }, false},
+				{"a larger margin", func(a *ProveModelCircuit) { a.Margin.Delta = 153 }, false},
+			},
+		},
+	}
+	for _, c := range cases {
+		data := testProverData(assert)
+		c.setup(data)
+		assert.NoError(solve(assert, data), c.name)
+		for _, tamper := range c.tampers {
+			err := solve(assert, data, tamper.apply)
+			if tamper.holds {
+				assert.NoError(err, c.name, tamper.what)
+			} else {
+				assert.Error(err, c.name, tamper.what)
+			}
+		}
+		if c.refuse != nil {
+			c.refuse(data)
+			assert.Error(solve(assert, data), c.name)
+		}
+	}
+}
+
+type marginCircuit struct {
+	Outputs []frontend.Variable
+	Index   frontend.Variable
+	Margin  frontend.Variable
+}
+
+func (c *marginCircuit) Define(api frontend.API) error {
+	fp := fixedpoint.NewAPI(api)
+	outputs := make([]fixedpoint.Fixed, len(c.Outputs))
+	for i := range c.Outputs {
+		outputs[i] = fixedpoint.New(c.Outputs[i], fixedpoint.Scale)
+	}
+	maxIdx, margin := argmaxMargin(api, fp, outputs)
+	api.AssertIsEqual(maxIdx, argmax(api, fp, outputs))
+	api.AssertIsEqual(maxIdx, c.Index)
+	api.AssertIsEqual(margin.V, c.Margin)
+	return nil
+}
+
+func TestArgmaxMargin(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	cases := []struct {
+		outputs       []int64
+		index, margin int64
+	}{
+		{[]int64{3, 7, 5, 7}, 1, 0},
+		{[]int64{9, 2, 8, 1}, 0, 1},
+		{[]int64{1, 2, 3, 10}, 3, 7},
+		{[]int64{5, 9, 1, 8}, 1, 1},
+		{[]int64{4, 1}, 0, 3},
+	}
+	for _, c := range cases {
+		values := make([]fixedpoint.Value, len(c.outputs))
+		assignment := &marginCircuit{Outputs: make([]frontend.Variable, len(c.outputs)), Index: c.index, Margin: c.margin}
+		for i, v := range c.outputs {
+			values[i] = fixedpoint.NewValue(v, fixedpoint.Scale)
+			assignment.Outputs[i] = v
+		}
+		assert.Equal(c.margin, margin(values).V.Int64(), c.outputs)
+
+		circuit := &marginCircuit{Outputs: make([]frontend.Variable, len(c.outputs))}
+		assert.NoError(test.IsSolved(circuit, assignment, ecc.BN254.ScalarField()), c.outputs)
+	}
+}
+
+func TestLipschitzBound(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	// the largest row sums are 1.85 and 1.84
+	data := testProverData(assert)
+	shape, err := data.Model.Shape()
+	assert.NoError(err)
+
+	field := ecc.BN254.ScalarField()
+	ccs, err := frontend.Compile(field, r1cs.NewBuilder, NewLipschitzCircuit(shape, data.Model.Quant()))
+	assert.NoError(err)
+
+	assignment, err := NewLipschitzAssignment(data.Model, fixedpoint.MustDecimal("3.404"))
+	assert.NoError(err)
+	witness, err := frontend.NewWitness(assignment, field)
+	assert.NoError(err)
+	assert.NoError(ccs.IsSolved(witness))
+
+	_, err = NewLipschitzAssignment(data.Model, fixedpoint.MustDecimal("3.403"))
+	assert.Error(err)
+
+	// a finer claim is rounded down, and the metadata states what was proven
+	finer, err := NewLipschitzAssignment(data.Model, fixedpoint.MustDecimal("3.4049"))
+	assert.NoError(err)
+	meta := NewLipschitzMetadata(shape, data.Model.Quant(), finer)
+	assert.Equal("3.404", meta.Bound.String())
+	public, err := fixedpoint.Quantize(meta.Bound, fixedpoint.Scale, fixedpoint.Exact)
+	assert.NoError(err)
+	assert.Equal(finer.Bound, public.Variable())
+
+	assignment.Bound = 3403
+	witness, err = frontend.NewWitness(assignment, field)
+	assert.NoError(err)
+	assert.Error(ccs.IsSolved(witness))
+
+	// smaller weights give a smaller bound, but not for the committed model
+	assignment.Bound = 3404
+	assignment.Weights[0][2][0] = -900
+	witness, err = frontend.NewWitness(assignment, field)
+	assert.NoError(err)
+	assert.Error(ccs.IsSolved(witness))
+
+	// the commitment covers the activations, so the same weights with another
+	// activation have another commitment, which the ReLU circuit refuses
+	data.Model.Layers = []Layer{{Type: Dense, Activation: HardTanh}, {Type: Dense, Activation: NoActivation}}
+	other, err := NewLipschitzAssignment(data.Model, fixedpoint.MustDecimal("3.404"))
+	assert.NoError(err)
+	assert.NotEqual(0, other.Commitment.(*big.Int).Cmp(finer.Commitment.(*big.Int)))
+	witness, err = frontend.NewWitness(other, field)
+	assert.NoError(err)
+	assert.Error(ccs.IsSolved(witness))
+	data.Model.Layers = nil
+
+	// the bound needs every activation 1-Lipschitz, being non-decreasing isn't enough
+	steep := activationFn{Kind: LeakyReLU, Slope: fixedpoint.NewValue(1500, fixedpoint.Scale)}
+	assert.False(steep.oneLipschitz(fixedpoint.Floor))
+	steep.Slope = fixedpoint.NewValue(1000, fixedpoint.Scale)
+	assert.True(steep.oneLipschitz(fixedpoint.Floor))
+	steep.Kind, steep.Slope = HardSigmoid, fixedpoint.NewValue(1001, fixedpoint.Scale)
+	assert.False(steep.oneLipschitz(fixedpoint.Floor))
+
+	// tables are checked step by step: tanh never rises faster than 1, so it is
+	// accepted, while GELU's slope reaches about 1.13 near 1.5, so it is refused
+	table := &ActivationTable{Min: fixedpoint.MustDecimal("-3"), Max: fixedpoint.MustDecimal("3")}
+	data.Model.ActivationTable = table
+	data.Model.Layers = []Layer{{Type: Dense, Activation: Tanh}, {Type: Dense, Activation: NoActivation}}
+	_, err = NewLipschitzAssignment(data.Model, fixedpoint.MustDecimal("3.404"))
+	assert.NoError(err)
+	data.Model.Layers[0].Activation = GELU
+	_, err = NewLipschitzAssignment(data.Model, fixedpoint.MustDecimal("3.404"))
+	assert.ErrorContains(err, "gelu isn't 1-Lipschitz")
+
+	// the circuit never reads the activations, so the verifier checks them again
+	meta.Shape, err = data.Model.Shape()
+	assert.NoError(err)
+	_, err = LipschitzPublicAssignment(&meta)
+	assert.ErrorContains(err, "gelu isn't 1-Lipschitz")
+}
+
+func TestSimulate(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	data := testProverData(assert)
+	var out bytes.Buffer
+	predictions, err := Simulate(&out, data.Model, data.Inputs, data.Expected)
+	assert.NoError(err)
+	assert.Equal([]int{2}, predictions)
+	assert.Equal(`input 0: [-0.22 0.03 0.18]
+  layer 0 dense: [0 0.097 1.052]
+  layer 1 dense: [0 0 0.152]
+  predicted class 2, matches outputs.json
+0 of 1 inputs disagree with outputs.json
+`, out.String())
+
+	// a stale label is reported, and the prediction is what the circuit accepts
+	out.Reset()
+	predictions, err = Simulate(&out, data.Model, data.Inputs, &ExpectedData{Expected: []int{0}})
+	assert.NoError(err)
+	assert.True(strings.Contains(out.String(), "predicted class 2, outputs.json says 0"), out.String())
+	data.Expected.Expected = predictions
+	assert.NoError(solve(assert, data))
+}
+
+func TestQuantReport(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	data := testProverData(assert)
+	c, err := compareQuant(data.Model, data.Inputs, data.Model.Quant())
+	assert.NoError(err)
+	assert.Empty(c.Mismatches)
+	// the layers only lose what flooring each rescale drops
+	for layer := range c.MaxError {
+		assert.True(c.MaxError[layer] < 0.002, "layer %d is off by %v", layer, c.MaxError[layer])
+		assert.True(c.MeanError[layer] <= c.MaxError[layer])
+	}
+
+	// 0.5 against 0.501 needs three decimals to tell apart
+	var m ModelData
+	assert.NoError(json.Unmarshal([]byte(`{"weights": [[[1], [1.01]]], "biases": [[0, -0.004]]}`), &m))
+	in := &InputData{Inputs: [][]fixedpoint.Decimal{{fixedpoint.MustDecimal("0.5")}}}
+	quant := m.Quant()
+	quant.InputScale, quant.WeightScale, quant.ActivationScale = 100, fixedpoint.Factors{100}, fixedpoint.Factors{100}
+	quant.Rounding = fixedpoint.HalfUp
+	c, err = compareQuant(&m, in, quant)
+	assert.NoError(err)
+	assert.Equal([]int{0}, c.Mismatches)
+	assert.Equal([]int{1}, c.FloatLabels)
+	scale, err := smallestAgreeingScale(&m, in)
+	assert.NoError(err)
+	assert.Equal(fixedpoint.Factor(1000), scale)
+
+	var out bytes.Buffer
+	assert.NoError(QuantReport(&out, &m, in))
+	assert.True(strings.Contains(out.String(), "0 of 1 inputs get a different class than with floats"), out.String())
+	assert.True(strings.Contains(out.String(), "smallest scale where every class agrees with floats: 10^3"), out.String())
+
+	// a bias of 1e-12 needs its square past an int64, the search stops before
+	m = ModelData{}
+	assert.NoError(json.Unmarshal([]byte(`{"weights": [[[1], [1]]], "biases": [[0, 0.000000000001]]}`), &m))
+	rounded := DefaultQuantConfig()
+	rounded.Rounding = fixedpoint.HalfUp
+	m.Quantization = &rounded
+	out.Reset()
+	assert.NoError(QuantReport(&out, &m, in))
+	assert.True(strings.Contains(out.String(), "no scale whose square fits in an int64 agrees with floats on every input"), out.String())
+}
+
+func TestOverflow(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	// 1.5 * 0.5 - 2 is -1.25, the sum -1250000 at the bias scale needs 22 signed bits
+	var m ModelData
+	assert.NoError(json.Unmarshal([]byte(`{"weights": [[[1.5]]], "biases": [[-2]]}`), &m))
+	data := &ProverData{Model: &m, Inputs: &InputData{Inputs: [][]fixedpoint.Decimal{{fixedpoint.MustDecimal("0.5")}}}, Expected: &ExpectedData{Expected: []int{0}}}
+	layers, fieldBits, err := data.overflow()
+	assert.NoError(err)
+	assert.Equal(254, fieldBits)
+	assert.Equal([]layerOverflow{{Layer: 0, Type: Dense, SumBits: 22, ValueBits: 12}}, layers)
+	assert.Equal(231, layers[0].FieldHeadroom(fieldBits))
+	assert.Equal(113, layers[0].RangeHeadroom(fieldBits))
+
+	// the bound covers the ball, and a wider one can be asked for
+	data.Ball = &BallData{Center: []fixedpoint.Decimal{fixedpoint.MustDecimal("0")}, Radius: fixedpoint.MustDecimal("10")}
+	layers, _, err = data.overflow()
+	assert.NoError(err)
+	assert.Equal(26, layers[0].SumBits)
+	bound := fixedpoint.MustDecimal("1e80")
+	data.InputBound = &bound
+	layers, _, err = data.overflow()
+	assert.NoError(err)
+	assert.True(layers[0].FieldHeadroom(fieldBits) < 0)
+	_, err = CircuitShape(data)
+	assert.ErrorContains(err, "could overflow")
+
+	var out bytes.Buffer
+	assert.NoError(OverflowReport(&out, data))
+	assert.True(strings.Contains(out.String(), "layer 0 can wrap around the field"), out.String())
+
+	// the test model has plenty of room
+	assert.NoError(testProverData(assert).checkOverflow())
+}
+
+func TestKeyStore(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	data := testProverData(assert)
+	shape, err := CircuitShape(data)
+	assert.NoError(err)
+	quant := data.Model.Quant()
+	id := CircuitID("model", "groth16", shape, quant)
+	store := KeyStore{Dir: t.TempDir()}
+	_, _, vk, err := store.Setup(id, NewProveModelCircuit(shape, quant))
+	assert.NoError(err)
+
+	// another model of the same shape reuses the keys, and its proof verifies against the first vk
+	data.Model.Biases[1][2] = fixedpoint.MustDecimal("0.7")
+	shape2, err := CircuitShape(data)
+	assert.NoError(err)
+	assert.Equal(id, CircuitID("model", "groth16", shape2, quant))
+	cs, pk, vk2, err := store.Setup(id, nil)
+	assert.NoError(err)
+	var first, second bytes.Buffer
+	_, err = vk.WriteTo(&first)
+	assert.NoError(err)
+	_, err = vk2.WriteTo(&second)
+	assert.NoError(err)
+	assert.Equal(first.Bytes(), second.Bytes())
+
+	assignment, err := NewAssignment(shape2, data)
+	assert.NoError(err)
+	witness, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
+	assert.NoError(err)
+	proof, err := store.ProofSystem().Prove(cs, pk, witness)
+	assert.NoError(err)
+	public, err := witness.Public()
+	assert.NoError(err)
+	assert.NoError(store.ProofSystem().Verify(proof, vk, public))
+
+	// anything that changes the constraints gets its own entry
+	shape2.BatchSize++
+	assert.NotEqual(id, CircuitID("model", "groth16", shape2, quant))
+	assert.NotEqual(id, CircuitID("lipschitz", "groth16", shape, quant))
+	assert.NotEqual(id, CircuitID("model", "plonk", shape, quant))
+	quant.Rescale = fixedpoint.HalfUp
+	assert.NotEqual(id, CircuitID("model", "groth16", shape, quant))
+}
+
+func TestPublicAssignment(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	// the radius is rounded down and epsilon up on both sides, whatever the
+	// model's rounding
+	data := testProverData(assert)
+	quant := DefaultQuantConfig()
+	quant.Rounding = fixedpoint.HalfUp
+	data.Model.Quantization = &quant
+	center := []fixedpoint.Decimal{fixedpoint.MustDecimal("-0.13"), fixedpoint.MustDecimal("0.06"), fixedpoint.MustDecimal("0.16")}
+	data.Ball = &BallData{Center: center, Radius: fixedpoint.MustDecimal("0.0999"), Norm: LInf}
+	data.Certify = &CertifyData{Center: center, Epsilon: fixedpoint.MustDecimal("0.1491"), Label: 2}
+	delta := fixedpoint.MustDecimal("0.1")
+	data.SameLabel, data.Margin, data.ReportMargin = true, &delta, true
+	shape, err := CircuitShape(data)
+	assert.NoError(err)
+	assignment, err := NewAssignment(shape, data)
+	assert.NoError(err)
+
+	meta := NewProofMetadata(shape, data, assignment)
+	assert.Equal("0.152", meta.SmallestMargin.String())
+	assert.Equal(2, *meta.Label)
+
+	field := ecc.BN254.ScalarField()
+	full, err := frontend.NewWitness(assignment, field)
+	assert.NoError(err)
+	want, err := full.Public()
+	assert.NoError(err)
+	public, err := PublicAssignment(&meta, data.Inputs)
+	assert.NoError(err)
+	got, err := frontend.NewWitness(public, field, frontend.PublicOnly())
+	assert.NoError(err)
+	assert.Equal(want.Vector(), got.Vector())
+
+	// metadata missing a public value is rejected
+	meta.Label = nil
+	_, err = PublicAssignment(&meta, data.Inputs)
+	assert.ErrorContains(err, "has none")
+	meta.Label = &data.Expected.Expected[0]
+	meta.Shape.SameLabel = false
+	_, err = PublicAssignment(&meta, data.Inputs)
+	assert.ErrorContains(err, "the metadata has a label but the proof doesn't use one")
+	meta.Shape.SameLabel = true
+	_, err = PublicAssignment(&meta, &InputData{Inputs: [][]fixedpoint.Decimal{center, center}})
+	assert.ErrorContains(err, "got 2 inputs")
+}
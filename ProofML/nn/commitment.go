@@ -0,0 +1,89 @@
+package nn
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/consensys/gnark/frontend"
+	stdmimc "github.com/consensys/gnark/std/hash/mimc"
+
+	"sudokuChecker/fixedpoint"
+)
+
+// architecture is the part of a shape that belongs to the model rather than
+// to a statement about it: the layers with their activations and the table
+func (s ModelShape) architecture() ModelShape {
+	return ModelShape{InputSize: s.InputSize, LayerSizes: s.LayerSizes, Input: s.Input, Layers: s.Layers, Table: s.Table}
+}
+
+// architectureTag is the SHA-256 of the model's architecture and quantization
+// as JSON, reduced into the field
+func architectureTag(shape ModelShape, quant QuantConfig) *big.Int {
+	description, err := json.Marshal(struct {
+		Shape ModelShape  `json:"shape"`
+		Quant QuantConfig `json:"quantization"`
+	}{shape.architecture(), quant})
+	if err != nil {
+		panic(err) // the shape and config always marshal
+	}
+	return fieldDigest(description)
+}
+
+// fieldDigest is the SHA-256 of data reduced into the field
+func fieldDigest(data []byte) *big.Int {
+	sum := sha256.Sum256(data)
+	var e fr.Element
+	e.SetBytes(sum[:])
+	return e.BigInt(new(big.Int))
+}
+
+// ModelDigest returns the MiMC hash of the quantized model, the value the
+// circuit exposes as its public Commitment. The architecture tag of shape and
+// quant comes first, so the layer kinds, activations and scales are committed
+// too, then each layer contributes its weights row by row followed by its
+// biases, one field element per value, with negative values reduced into the
+// field. Publishing the digest pins a model version: a proof made with any
+// other weights or activations has a different commitment.
+func ModelDigest(shape ModelShape, quant QuantConfig, weights [][][]fixedpoint.Value, biases [][]fixedpoint.Value) *big.Int {
+	h := mimc.NewMiMC()
+	write := func(v *big.Int) {
+		var e fr.Element
+		e.SetBigInt(v)
+		b := e.Bytes()
+		_, _ = h.Write(b[:])
+	}
+	write(architectureTag(shape, quant))
+	for layer := range weights {
+		for neuron := range weights[layer] {
+			for _, w := range weights[layer][neuron] {
+				write(w.V)
+			}
+		}
+		for _, b := range biases[layer] {
+			write(b.V)
+		}
+	}
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
+
+// assertCommitment hashes the architecture tag, weights and biases in the
+// order ModelDigest uses and constrains the result to equal the public
+// commitment. The tag is a constant of the circuit.
+func assertCommitment(api frontend.API, shape ModelShape, quant QuantConfig, weights [][][]frontend.Variable, biases [][]frontend.Variable, commitment frontend.Variable) error {
+	h, err := stdmimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	h.Write(architectureTag(shape, quant))
+	for layer := range weights {
+		for neuron := range weights[layer] {
+			h.Write(weights[layer][neuron]...)
+		}
+		h.Write(biases[layer]...)
+	}
+	api.AssertIsEqual(h.Sum(), commitment)
+	return nil
+}
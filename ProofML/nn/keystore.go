@@ -0,0 +1,137 @@
+package nn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+
+	"sudokuChecker/proofsystem"
+)
+
+// keyStoreVersion is hashed into every circuit id. Bump it when Define changes
+// the constraints of an existing shape, so stale keys are no longer picked up.
+const keyStoreVersion = 3
+
+// CircuitID names a circuit by what decides its constraints: the kind of
+// statement, the backend, the shape and the quantization. The weights are
+// private and committed to, so every model of one shape shares one circuit and
+// one key.
+func CircuitID(kind, backend string, shape ModelShape, quant QuantConfig) string {
+	sum := sha256.Sum256(describeCircuit(kind, backend, shape, quant))
+	return hex.EncodeToString(sum[:16])
+}
+
+// CircuitTag is the digest of what CircuitID names but the backend, which the
+// circuit doesn't know it is compiled for. Both circuits take it as their
+// first public input and constrain it to this constant, so a proof only
+// verifies against a public witness rebuilt with the kind, shape and
+// quantization its key was set up for, whatever the metadata claims.
+func CircuitTag(kind string, shape ModelShape, quant QuantConfig) *big.Int {
+	return fieldDigest(describeCircuit(kind, "", shape, quant))
+}
+
+// WitnessTag reads the circuit tag out of the public witness of a proof of
+// either circuit, for a verifier to check against the shape it was told
+func WitnessTag(publicWitness witness.Witness) (*big.Int, error) {
+	vector, ok := publicWitness.Vector().(fr.Vector)
+	if !ok || len(vector) == 0 {
+		return nil, fmt.Errorf("the public witness has no circuit tag")
+	}
+	return vector[0].BigInt(new(big.Int)), nil
+}
+
+// describeCircuit is the JSON CircuitID and CircuitTag hash
+func describeCircuit(kind, backend string, shape ModelShape, quant QuantConfig) []byte {
+	description, err := json.Marshal(struct {
+		Version int         `json:"version"`
+		Curve   string      `json:"curve"`
+		Backend string      `json:"backend"`
+		Kind    string      `json:"kind"`
+		Shape   ModelShape  `json:"shape"`
+		Quant   QuantConfig `json:"quantization"`
+	}{keyStoreVersion, ecc.BN254.String(), backend, kind, shape, quant})
+	if err != nil {
+		panic(err) // the shape and config always marshal
+	}
+	return description
+}
+
+// KeyStore keeps the compiled constraint system and the keys of every circuit
+// it has set up, in a directory per circuit id. Setup runs once per shape, so
+// every proof of that shape verifies against the same vk.
+type KeyStore struct {
+	Dir     string
+	Backend proofsystem.Backend // Groth16 when nil
+}
+
+// ProofSystem is the backend the store sets circuits up with
+func (s KeyStore) ProofSystem() proofsystem.Backend {
+	if s.Backend == nil {
+		return proofsystem.Groth16{}
+	}
+	return s.Backend
+}
+
+// Setup returns the constraint system and keys of the circuit with the given
+// id, compiling circuit and running the setup only if the store doesn't hold
+// them yet
+func (s KeyStore) Setup(id string, circuit frontend.Circuit) (constraint.ConstraintSystem, proofsystem.ProvingKey, proofsystem.VerifyingKey, error) {
+	backend := s.ProofSystem()
+	files := backend.Files()
+	setupID, err := backend.SetupID()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// PLONK keys also depend on the SRS, keep them apart per SRS
+	dir := filepath.Join(s.Dir, id)
+	if setupID != "" {
+		dir += "-" + setupID
+	}
+	cs := backend.NewCS()
+	pk, vk := backend.NewProvingKey(), backend.NewVerifyingKey()
+	if _, err := os.Stat(filepath.Join(dir, files.VK)); err == nil {
+		if err := proofsystem.ReadFrom(filepath.Join(dir, files.CS), cs); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := proofsystem.ReadFrom(filepath.Join(dir, files.PK), pk); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := proofsystem.ReadFrom(filepath.Join(dir, files.VK), vk); err != nil {
+			return nil, nil, nil, err
+		}
+		return cs, pk, vk, nil
+	}
+
+	cs, err = backend.Compile(circuit)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("compiling circuit: %w", err)
+	}
+	pk, vk, err = backend.Setup(cs)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("setup: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, nil, nil, err
+	}
+	// the vk goes last, its presence marks a complete entry
+	for _, f := range []struct {
+		name string
+		v    io.WriterTo
+	}{{files.CS, cs}, {files.PK, pk}, {files.VK, vk}} {
+		if err := proofsystem.WriteTo(filepath.Join(dir, f.name), f.v); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return cs, pk, vk, nil
+}
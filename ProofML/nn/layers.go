@@ -0,0 +1,260 @@
+package nn
+
+import (
+	"fmt"
+
+	"sudokuChecker/fixedpoint"
+)
+
+// LayerType is the kind of a layer in the "layers" section of weights.json
+type LayerType string
+
+const (
+	Dense   LayerType = "dense"   // fully connected, one weight row per neuron
+	Conv2D  LayerType = "conv2d"  // 2D convolution, one weight row per output channel
+	MaxPool LayerType = "maxpool" // largest value of each window
+	AvgPool LayerType = "avgpool" // mean of each window, rounded like a rescale
+	Flatten LayerType = "flatten" // turns channels x height x width into a vector
+)
+
+// Activation is applied to the outputs of a dense or conv2d layer
+type Activation string
+
+const (
+	ReLU         Activation = "relu"        // max(0, x), the default
+	LeakyReLU    Activation = "leakyrelu"   // x, or slope*x below zero
+	ClippedReLU  Activation = "clippedrelu" // min(max(0, x), cap), ReLU6 with a cap of 6
+	HardSigmoid  Activation = "hardsigmoid" // min(max(0, slope*x + 0.5), 1)
+	HardTanh     Activation = "hardtanh"    // min(max(-cap, x), cap), a piecewise-linear tanh
+	Sigmoid      Activation = "sigmoid"     // 1/(1+e^-x), needs an activation table
+	Tanh         Activation = "tanh"        // needs an activation table
+	GELU         Activation = "gelu"        // x*Phi(x), needs an activation table and isn't monotone
+	NoActivation Activation = "none"        // keep the rescaled sums, usually for the final logits
+)
+
+// Layer is one entry of the optional "layers" section of weights.json. Dense
+// and conv2d layers take the next entry of "weights" and "biases" and are
+// followed by their activation. A conv2d weight row is the kernel of one output channel,
+// flattened in input channel, row, column order, with one bias per channel.
+// Without a "layers" section every entry of "weights" is a dense layer.
+type Layer struct {
+	Type    LayerType `json:"type"`
+	Kernel  int       `json:"kernel,omitempty"`  // side of the square window, conv2d and pooling
+	Stride  int       `json:"stride,omitempty"`  // 1 for conv2d and the kernel size for pooling when not set
+	Padding int       `json:"padding,omitempty"` // zeros added on every side, conv2d only
+
+	Activation Activation          `json:"activation,omitempty"` // dense and conv2d only, ReLU when not set
+	Slope      *fixedpoint.Decimal `json:"slope,omitempty"`      // leaky ReLU (0.01) and hard sigmoid (0.2) only, between 0 and 1
+	Cap        *fixedpoint.Decimal `json:"cap,omitempty"`        // clipped ReLU (required) and hard tanh (1) only
+}
+
+// activation returns the layer's activation with the default filled in
+func (l Layer) activation() Activation {
+	if l.Activation == "" {
+		return ReLU
+	}
+	return l.Activation
+}
+
+// Tensor is the channels x height x width shape of a layer's values. Values
+// are stored flat in channel, row, column order, so a vector has height and
+// width 1 and inputs.json lists images channel by channel, row by row.
+type Tensor struct {
+	Channels int `json:"channels"`
+	Height   int `json:"height"`
+	Width    int `json:"width"`
+}
+
+// Size returns the number of values in the tensor
+func (t Tensor) Size() int {
+	return t.Channels * t.Height * t.Width
+}
+
+func (t Tensor) String() string {
+	return fmt.Sprintf("%dx%dx%d", t.Channels, t.Height, t.Width)
+}
+
+func (t Tensor) index(c, y, x int) int {
+	return (c*t.Height+y)*t.Width + x
+}
+
+func (t Tensor) isVector() bool {
+	return t.Height == 1 && t.Width == 1
+}
+
+// layerPlan is a layer together with the shapes it maps between
+type layerPlan struct {
+	Layer
+	In, Out Tensor
+	Param   int // index into Weights and Biases, -1 for layers without parameters
+	FanIn   int // number of weights per row
+
+	Table *ActivationTable // the model's activation table, nil to compute activations
+}
+
+// neuron is one output of a dense or conv2d layer: the weight row it uses and
+// which input each weight of the row multiplies, -1 for zero padding
+type neuron struct {
+	Row    int
+	Inputs []int
+}
+
+// plan resolves the layers of the shape into the tensors flowing between them
+func (s ModelShape) plan() ([]layerPlan, error) {
+	in := Tensor{Channels: s.InputSize, Height: 1, Width: 1}
+	if s.Input != nil {
+		in = *s.Input
+		if in.Channels <= 0 || in.Height <= 0 || in.Width <= 0 {
+			return nil, fmt.Errorf("input shape %v has an empty dimension", in)
+		}
+		if in.Size() != s.InputSize {
+			return nil, fmt.Errorf("input shape %v holds %d values, not %d", in, in.Size(), s.InputSize)
+		}
+	}
+	layers := s.Layers
+	if layers == nil {
+		for range s.LayerSizes {
+			layers = append(layers, Layer{Type: Dense})
+		}
+	}
+
+	plan := make([]layerPlan, len(layers))
+	param := 0
+	for i, l := range layers {
+		p := layerPlan{Layer: l, In: in, Param: -1, Table: s.Table}
+		switch l.Type {
+		case Dense, Conv2D:
+			if err := l.checkActivation(); err != nil {
+				return nil, fmt.Errorf("layer %d: %w", i, err)
+			}
+			if l.activation().needsTable() && s.Table == nil {
+				return nil, fmt.Errorf("layer %d: %s needs an activation table", i, l.activation())
+			}
+			if param >= len(s.LayerSizes) {
+				return nil, fmt.Errorf("layer %d is the %s layer number %d, but there are only %d weight layers", i, l.Type, param+1, len(s.LayerSizes))
+			}
+			p.Param = param
+			param++
+		default:
+			if l.Activation != "" || l.Slope != nil || l.Cap != nil {
+				return nil, fmt.Errorf("layer %d: %s layers have no activation", i, l.Type)
+			}
+		}
+
+		switch l.Type {
+		case Dense:
+			if !in.isVector() {
+				return nil, fmt.Errorf("layer %d: dense layers take a vector, not %v, add a flatten layer", i, in)
+			}
+			p.FanIn = in.Size()
+			p.Out = Tensor{Channels: s.LayerSizes[p.Param], Height: 1, Width: 1}
+		case Conv2D:
+			if p.Stride == 0 {
+				p.Stride = 1
+			}
+			out, err := windowed(in, p.Layer)
+			if err != nil {
+				return nil, fmt.Errorf("layer %d: %w", i, err)
+			}
+			p.FanIn = in.Channels * p.Kernel * p.Kernel
+			p.Out = Tensor{Channels: s.LayerSizes[p.Param], Height: out.Height, Width: out.Width}
+		case MaxPool, AvgPool:
+			if p.Stride == 0 {
+				p.Stride = p.Kernel
+			}
+			if p.Padding != 0 {
+				return nil, fmt.Errorf("layer %d: %s layers can't be padded", i, l.Type)
+			}
+			out, err := windowed(in, p.Layer)
+			if err != nil {
+				return nil, fmt.Errorf("layer %d: %w", i, err)
+			}
+			p.Out = out
+		case Flatten:
+			p.Out = Tensor{Channels: in.Size(), Height: 1, Width: 1}
+		default:
+			return nil, fmt.Errorf("layer %d has unknown type %q, expected %q, %q, %q, %q or %q", i, l.Type, Dense, Conv2D, MaxPool, AvgPool, Flatten)
+		}
+		plan[i] = p
+		in = p.Out
+	}
+	if param != len(s.LayerSizes) {
+		return nil, fmt.Errorf("got %d weight layers but the layers use %d", len(s.LayerSizes), param)
+	}
+	return plan, nil
+}
+
+// windowed returns the shape after sliding l's window over in
+func windowed(in Tensor, l Layer) (Tensor, error) {
+	if l.Kernel <= 0 || l.Stride <= 0 || l.Padding < 0 {
+		return Tensor{}, fmt.Errorf("%s needs a positive kernel and stride and no negative padding", l.Type)
+	}
+	if in.Height+2*l.Padding < l.Kernel || in.Width+2*l.Padding < l.Kernel {
+		return Tensor{}, fmt.Errorf("%s kernel %d is larger than its %v input", l.Type, l.Kernel, in)
+	}
+	h := (in.Height+2*l.Padding-l.Kernel)/l.Stride + 1
+	w := (in.Width+2*l.Padding-l.Kernel)/l.Stride + 1
+	return Tensor{Channels: in.Channels, Height: h, Width: w}, nil
+}
+
+// outputSize returns the number of values the final layer produces
+func outputSize(plan []layerPlan) int {
+	return plan[len(plan)-1].Out.Size()
+}
+
+// neurons lists the outputs of a dense or conv2d layer, in output order
+func (p layerPlan) neurons() []neuron {
+	if p.Type == Dense {
+		inputs := make([]int, p.In.Size())
+		for j := range inputs {
+			inputs[j] = j
+		}
+		res := make([]neuron, p.Out.Size())
+		for i := range res {
+			res[i] = neuron{Row: i, Inputs: inputs}
+		}
+		return res
+	}
+
+	res := make([]neuron, 0, p.Out.Size())
+	for c := 0; c < p.Out.Channels; c++ {
+		for y := 0; y < p.Out.Height; y++ {
+			for x := 0; x < p.Out.Width; x++ {
+				inputs := make([]int, 0, p.FanIn)
+				for ic := 0; ic < p.In.Channels; ic++ {
+					for ky := 0; ky < p.Kernel; ky++ {
+						for kx := 0; kx < p.Kernel; kx++ {
+							iy, ix := y*p.Stride-p.Padding+ky, x*p.Stride-p.Padding+kx
+							if iy < 0 || iy >= p.In.Height || ix < 0 || ix >= p.In.Width {
+								inputs = append(inputs, -1)
+							} else {
+								inputs = append(inputs, p.In.index(ic, iy, ix))
+							}
+						}
+					}
+				}
+				res = append(res, neuron{Row: c, Inputs: inputs})
+			}
+		}
+	}
+	return res
+}
+
+// windows lists the inputs each output of a pooling layer covers, in output order
+func (p layerPlan) windows() [][]int {
+	res := make([][]int, 0, p.Out.Size())
+	for c := 0; c < p.Out.Channels; c++ {
+		for y := 0; y < p.Out.Height; y++ {
+			for x := 0; x < p.Out.Width; x++ {
+				window := make([]int, 0, p.Kernel*p.Kernel)
+				for ky := 0; ky < p.Kernel; ky++ {
+					for kx := 0; kx < p.Kernel; kx++ {
+						window = append(window, p.In.index(c, y*p.Stride+ky, x*p.Stride+kx))
+					}
+				}
+				res = append(res, window)
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,362 @@
+package nn
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/test"
+
+	"sudokuChecker/fixedpoint"
+)
+
+// testConvModel is a 1x4x4 image model: conv2d to 2x4x4, max pooling to
+// 2x2x2, average pooling to 2x1x1, then a dense layer with 3 classes
+const testConvModel = `{
+	"input": {"channels": 1, "height": 4, "width": 4},
+	"layers": [
+		{"type": "conv2d", "kernel": 3, "padding": 1},
+		{"type": "maxpool", "kernel": 2},
+		{"type": "avgpool", "kernel": 2},
+		{"type": "flatten"},
+		{"type": "dense"}
+	],
+	"weights": [
+		[[0.1, -0.2, 0.3, 0.05, 0.5, -0.1, 0.2, 0.1, -0.3], [-0.4, 0.2, 0.1, 0.3, -0.2, 0.6, 0.1, -0.1, 0.2]],
+		[[0.7, -0.5], [-0.3, 0.9], [0.2, 0.2]]
+	],
+	"biases": [[0.01, -0.02], [0.1, 0.05, -0.01]]
+}`
+
+func testImages() [][]fixedpoint.Decimal {
+	raw := [][]string{
+		{"0.1", "0.9", "-0.3", "0.4", "0.25", "0.5", "0.75", "-0.1", "0.3", "0.2", "0.1", "0", "-0.6", "0.8", "0.35", "0.45"},
+		{"0.9", "0.8", "0.7", "0.6", "0.5", "0.4", "0.3", "0.2", "0.1", "0", "-0.1", "-0.2", "-0.3", "-0.4", "-0.5", "-0.6"},
+	}
+	images := make([][]fixedpoint.Decimal, len(raw))
+	for i := range raw {
+		for _, v := range raw[i] {
+			images[i] = append(images[i], fixedpoint.MustDecimal(v))
+		}
+	}
+	return images
+}
+
+// forwardCircuit runs ProveModelCircuit.forward and checks every output
+type forwardCircuit struct {
+	Weights [][][]frontend.Variable
+	Biases  [][]frontend.Variable
+	Input   []frontend.Variable
+	Outputs []frontend.Variable
+
+	Shape ModelShape  `gnark:"-"`
+	Quant QuantConfig `gnark:"-"`
+}
+
+func (c *forwardCircuit) Define(api frontend.API) error {
+	model := &ProveModelCircuit{Weights: c.Weights, Biases: c.Biases, Shape: c.Shape, Quant: c.Quant}
+	plan, err := c.Shape.plan()
+	if err != nil {
+		return err
+	}
+	input := make([]fixedpoint.Fixed, len(c.Input))
+	for i := range c.Input {
+		input[i] = fixedpoint.New(c.Input[i], int64(c.Quant.InputScale))
+	}
+	outputs := model.forward(api, fixedpoint.NewAPI(api), plan, input)
+	for i := range outputs {
+		api.AssertIsEqual(outputs[i].V, c.Outputs[i])
+	}
+	return nil
+}
+
+func TestConvPlan(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	// the 3x3 image 1..9, summed by a 2x2 kernel of ones with stride 2 and padding 1
+	shape := ModelShape{
+		InputSize:  9,
+		LayerSizes: []int{1},
+		Input:      &Tensor{Channels: 1, Height: 3, Width: 3},
+		Layers:     []Layer{{Type: Conv2D, Kernel: 2, Stride: 2, Padding: 1}},
+	}
+	plan, err := shape.plan()
+	assert.NoError(err)
+	assert.Equal(Tensor{Channels: 1, Height: 2, Width: 2}, plan[0].Out)
+
+	quant := DefaultQuantConfig()
+	one := fixedpoint.NewValue(1000, 1000)
+	weights := [][][]fixedpoint.Value{{{one, one, one, one}}}
+	biases := [][]fixedpoint.Value{{fixedpoint.NewValue(0, 1000000)}}
+	image := make([]fixedpoint.Value, 9)
+	for i := range image {
+		image[i] = fixedpoint.NewValue(int64(i+1), 1000)
+	}
+	outputs := forwardValues(plan, weights, biases, image, quant)
+	for i, want := range []int64{1, 5, 11, 28} {
+		assert.Equal(want, outputs[i].V.Int64(), i)
+	}
+
+	// pooling the result: the max is 28 and the floored mean of 45/4 is 11
+	for layerType, want := range map[LayerType]int64{MaxPool: 28, AvgPool: 11} {
+		pooled := shape
+		pooled.Layers = append([]Layer{}, shape.Layers...)
+		pooled.Layers = append(pooled.Layers, Layer{Type: layerType, Kernel: 2})
+		plan, err := pooled.plan()
+		assert.NoError(err)
+		assert.Equal(want, forwardValues(plan, weights, biases, image, quant)[0].V.Int64(), layerType)
+	}
+
+	// dense layers need a flatten first
+	shape.Layers = append(shape.Layers, Layer{Type: Dense})
+	shape.LayerSizes = append(shape.LayerSizes, 2)
+	_, err = shape.plan()
+	assert.Error(err)
+}
+
+func TestConvForwardMatchesHost(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	var m ModelData
+	assert.NoError(json.Unmarshal([]byte(testConvModel), &m))
+	shape, err := m.Shape()
+	assert.NoError(err)
+	assert.Equal(3, shape.OutputSize())
+	plan, err := shape.plan()
+	assert.NoError(err)
+	weights, biases, err := m.Quantize()
+	assert.NoError(err)
+
+	for _, mode := range []fixedpoint.Rounding{fixedpoint.Floor, fixedpoint.HalfUp} {
+		quant := m.Quant()
+		quant.Rescale = mode
+		for _, image := range testImages() {
+			model := NewProveModelCircuit(shape, quant)
+			circuit := &forwardCircuit{Weights: model.Weights, Biases: model.Biases, Input: make([]frontend.Variable, shape.InputSize), Outputs: make([]frontend.Variable, 3), Shape: shape, Quant: quant}
+			assignment := &forwardCircuit{Weights: model.Weights, Biases: model.Biases, Input: make([]frontend.Variable, shape.InputSize), Outputs: make([]frontend.Variable, 3)}
+
+			input := make([]fixedpoint.Value, len(image))
+			for i := range image {
+				input[i], err = fixedpoint.Quantize(image[i], int64(quant.InputScale), quant.Rounding)
+				assert.NoError(err)
+				assignment.Input[i] = input[i].Variable()
+			}
+			assignment.Weights = make([][][]frontend.Variable, len(weights))
+			assignment.Biases = make([][]frontend.Variable, len(biases))
+			for layer := range weights {
+				assignment.Weights[layer] = make([][]frontend.Variable, len(weights[layer]))
+				assignment.Biases[layer] = make([]frontend.Variable, len(biases[layer]))
+				for row := range weights[layer] {
+					assignment.Weights[layer][row] = make([]frontend.Variable, len(weights[layer][row]))
+					for j := range weights[layer][row] {
+						assignment.Weights[layer][row][j] = weights[layer][row][j].Variable()
+					}
+					assignment.Biases[layer][row] = biases[layer][row].Variable()
+				}
+			}
+			for i, v := range forwardValues(plan, weights, biases, input, quant) {
+				assignment.Outputs[i] = v.Variable()
+			}
+
+			field := ecc.BN254.ScalarField()
+			ccs, err := frontend.Compile(field, r1cs.NewBuilder, circuit)
+			assert.NoError(err)
+			witness, err := frontend.NewWitness(assignment, field)
+			assert.NoError(err)
+			assert.NoError(ccs.IsSolved(witness), mode)
+		}
+	}
+}
+
+func TestConvModelProof(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	slope := fixedpoint.MustDecimal("0.1")
+	for _, activation := range []Layer{{Activation: ReLU}, {Activation: LeakyReLU, Slope: &slope}, {Activation: HardTanh}} {
+		var m ModelData
+		assert.NoError(json.Unmarshal([]byte(testConvModel), &m))
+		m.Layers[0].Activation, m.Layers[0].Slope = activation.Activation, activation.Slope
+		shape, err := m.Shape()
+		assert.NoError(err)
+		plan, err := shape.plan()
+		assert.NoError(err)
+		weights, biases, err := m.Quantize()
+		assert.NoError(err)
+
+		images := testImages()
+		data := &ProverData{Model: &m, Inputs: &InputData{Inputs: images}, Expected: &ExpectedData{}}
+		for _, image := range images {
+			input := make([]fixedpoint.Value, len(image))
+			for i := range image {
+				input[i], err = fixedpoint.Quantize(image[i], fixedpoint.Scale, fixedpoint.Exact)
+				assert.NoError(err)
+			}
+			data.Expected.Expected = append(data.Expected.Expected, predict(plan, weights, biases, input, m.Quant()))
+		}
+		// bounds also pass through the convolution, the activation and both poolings
+		data.Certify = &CertifyData{Center: images[0], Epsilon: fixedpoint.MustDecimal("0.01"), Label: data.Expected.Expected[0]}
+
+		assert.NoError(solve(assert, data), activation.Activation)
+
+		// a wrong label for the second image fails
+		assert.Error(solve(assert, data, func(a *ProveModelCircuit) {
+			a.Expected[1] = (data.Expected.Expected[1] + 1) % 3
+		}))
+	}
+}
+
+// activationCircuit applies an activation to every input and checks the outputs
+type activationCircuit struct {
+	Inputs  []frontend.Variable
+	Outputs []frontend.Variable
+
+	Activation activationFn        `gnark:"-"`
+	Mode       fixedpoint.Rounding `gnark:"-"`
+}
+
+func (c *activationCircuit) Define(api frontend.API) error {
+	fp := fixedpoint.NewAPI(api)
+	for i := range c.Inputs {
+		out := c.Activation.define(fp, fixedpoint.New(c.Inputs[i], fixedpoint.Scale), c.Mode)
+		api.AssertIsEqual(out.V, c.Outputs[i])
+	}
+	return nil
+}
+
+func TestActivations(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	d := func(s string) *fixedpoint.Decimal {
+		v := fixedpoint.MustDecimal(s)
+		return &v
+	}
+	// inputs at fixedpoint.Scale, the last one far above the old 1e9 ReLU cutoff
+	inputs := []int64{-3000, -1501, -500, -1, 0, 1, 499, 1000, 7000, 5000000000000}
+	cases := []struct {
+		layer Layer
+		want  []int64
+	}{
+		{Layer{}, []int64{0, 0, 0, 0, 0, 1, 499, 1000, 7000, 5000000000000}},
+		{Layer{Activation: LeakyReLU}, []int64{-30, -16, -5, -1, 0, 1, 499, 1000, 7000, 5000000000000}},
+		{Layer{Activation: LeakyReLU, Slope: d("0.5")}, []int64{-1500, -751, -250, -1, 0, 1, 499, 1000, 7000, 5000000000000}},
+		{Layer{Activation: ClippedReLU, Cap: d("6")}, []int64{0, 0, 0, 0, 0, 1, 499, 1000, 6000, 6000}},
+		{Layer{Activation: HardSigmoid}, []int64{0, 199, 400, 499, 500, 500, 599, 700, 1000, 1000}},
+		{Layer{Activation: HardTanh}, []int64{-1000, -1000, -500, -1, 0, 1, 499, 1000, 1000, 1000}},
+		{Layer{Activation: NoActivation}, inputs},
+	}
+	for _, c := range cases {
+		assert.NoError(c.layer.checkActivation())
+		activation := layerPlan{Layer: c.layer}.activationFn(fixedpoint.Scale)
+		circuit := &activationCircuit{Inputs: make([]frontend.Variable, len(inputs)), Outputs: make([]frontend.Variable, len(inputs)), Activation: activation, Mode: fixedpoint.Floor}
+		assignment := &activationCircuit{Inputs: make([]frontend.Variable, len(inputs)), Outputs: make([]frontend.Variable, len(inputs))}
+		for i, v := range inputs {
+			out := activation.apply(fixedpoint.NewValue(v, fixedpoint.Scale), fixedpoint.Floor)
+			assert.Equal(c.want[i], out.V.Int64(), "%s of %d", c.layer.activation(), v)
+			assignment.Inputs[i] = v
+			assignment.Outputs[i] = out.Variable()
+		}
+
+		field := ecc.BN254.ScalarField()
+		ccs, err := frontend.Compile(field, r1cs.NewBuilder, circuit)
+		assert.NoError(err)
+		witness, err := frontend.NewWitness(assignment, field)
+		assert.NoError(err)
+		assert.NoError(ccs.IsSolved(witness), c.layer.activation())
+	}
+
+	for _, bad := range []Layer{
+		{Activation: "softplus"},
+		{Activation: ReLU, Cap: d("6")},
+		{Activation: LeakyReLU, Slope: d("1.5")},
+		{Activation: LeakyReLU, Slope: d("-0.1")},
+		{Activation: HardSigmoid, Slope: d("0")},
+		{Activation: ClippedReLU},
+		{Activation: HardTanh, Cap: d("-1")},
+	} {
+		assert.Error(bad.checkActivation(), bad)
+	}
+}
+
+func TestActivationTable(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	// the same ReLU network, and its certificate, through a table
+	data := testProverData(assert)
+	data.Certify = &CertifyData{Center: data.Inputs.Inputs[0], Epsilon: fixedpoint.MustDecimal("0.01"), Label: 2}
+	data.Model.ActivationTable = &ActivationTable{Min: fixedpoint.MustDecimal("-2"), Max: fixedpoint.MustDecimal("2")}
+	assert.NoError(solve(assert, data))
+
+	// sigmoid and GELU hidden layers
+	for _, activation := range []Activation{Sigmoid, GELU} {
+		data = testProverData(assert)
+		data.Model.Layers = []Layer{{Type: Dense, Activation: activation}, {Type: Dense, Activation: NoActivation}}
+		_, err := data.Model.Shape()
+		assert.Error(err, "%s without a table", activation)
+		data.Model.ActivationTable = &ActivationTable{Min: fixedpoint.MustDecimal("-2"), Max: fixedpoint.MustDecimal("2")}
+		assert.NoError(solve(assert, data), activation)
+	}
+	data.Certify = &CertifyData{Center: data.Inputs.Inputs[0], Label: 2}
+	_, err := CircuitShape(data)
+	assert.Error(err, "certified GELU")
+
+	// a sum outside the table, the first layer's third neuron is 1.052
+	data = testProverData(assert)
+	data.Model.ActivationTable = &ActivationTable{Min: fixedpoint.MustDecimal("-2"), Max: fixedpoint.MustDecimal("0.99")}
+	assert.ErrorContains(solve(assert, data), "outside the activation table")
+
+	// the 4x10x10 model, whose sums lie in [-7.415, 8.612], proves with either
+	m, err := LoadModel("../../size_4x10x10_weights.json")
+	assert.NoError(err)
+	inputs, err := LoadInputs("../../size_4x10x10_inputs.json")
+	assert.NoError(err)
+	expected, err := LoadExpected("../../size_4x10x10_outputs.json")
+	assert.NoError(err)
+	data = &ProverData{Model: m, Inputs: inputs, Expected: expected}
+	assert.NoError(solve(assert, data))
+	m.ActivationTable = &ActivationTable{Min: fixedpoint.MustDecimal("-8"), Max: fixedpoint.MustDecimal("9")}
+	assert.NoError(solve(assert, data))
+}
+
+// BenchmarkCompile compiles the example models and reports their constraint
+// counts: go test -run '^$' -bench Compile ./nn
+func BenchmarkCompile(b *testing.B) {
+	table := &ActivationTable{Min: fixedpoint.MustDecimal("-8"), Max: fixedpoint.MustDecimal("9")}
+	for _, c := range []struct {
+		name, prefix string
+		table        *ActivationTable
+	}{
+		{"8x10x10", "../Test/8", nil},
+		{"4x10x10", "../../size_4x10x10_", nil},
+		{"4x10x10-table", "../../size_4x10x10_", table},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			m, err := LoadModel(c.prefix + "weights.json")
+			if err != nil {
+				b.Fatal(err)
+			}
+			m.ActivationTable = c.table
+			inputs, err := LoadInputs(c.prefix + "inputs.json")
+			if err != nil {
+				b.Fatal(err)
+			}
+			expected, err := LoadExpected(c.prefix + "outputs.json")
+			if err != nil {
+				b.Fatal(err)
+			}
+			shape, err := CircuitShape(&ProverData{Model: m, Inputs: inputs, Expected: expected})
+			if err != nil {
+				b.Fatal(err)
+			}
+			var ccs constraint.ConstraintSystem
+			for i := 0; i < b.N; i++ {
+				if ccs, err = frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, NewProveModelCircuit(shape, m.Quant())); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(ccs.GetNbConstraints()), "constraints")
+		})
+	}
+}
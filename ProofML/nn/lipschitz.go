@@ -0,0 +1,276 @@
+package nn
+
+import (
+	"fmt"
+	"math/big"
+	"path/filepath"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+
+	"sudokuChecker/fixedpoint"
+	"sudokuChecker/proofsystem"
+)
+
+const LipschitzMetaFile = "lipschitz.meta.json"
+
+// LipschitzFiles names the verifying key and the proof of a Lipschitz proof
+// made with backend, lipschitz.g16vk and lipschitz.g16p for Groth16
+func LipschitzFiles(backend proofsystem.Backend) (vk, proof string) {
+	files := backend.Files()
+	return "lipschitz" + filepath.Ext(files.VK), "lipschitz" + filepath.Ext(files.Proof)
+}
+
+// LipschitzCircuit proves that the committed model is Bound-Lipschitz in the
+// L-infinity norm: no input change of size e moves any output by more than
+// Bound*e. The bound is the product of the layers' induced infinity norms,
+// their largest absolute row sums, which holds when every activation is
+// 1-Lipschitz, as CheckOneLipschitz checks. Define doesn't read the
+// activations, but the commitment covers them, so the bound only speaks for
+// model proofs made with the activations checked here.
+// A conv2d row is a kernel, whose absolute sum bounds the convolution the same
+// way, and pooling and flatten never increase distances. The bound covers the
+// real-valued network with the quantized weights.
+//
+// Together with a margin proven at a center it certifies a radius without
+// sampling: a margin above 2*Bound*e can't be overturned within e.
+type LipschitzCircuit struct {
+	Tag     frontend.Variable       `gnark:",public"` // CircuitTag of the architecture and quantization
+	Weights [][][]frontend.Variable `gnark:",private"`
+	Biases  [][]frontend.Variable   `gnark:",private"` // only hashed, the bound doesn't depend on them
+
+	Commitment frontend.Variable `gnark:",public"` // ModelDigest of the architecture, Weights and Biases
+	Bound      frontend.Variable `gnark:",public"` // claimed Lipschitz constant at fixedpoint.Scale
+
+	Shape ModelShape  `gnark:"-"` // architecture of the model, hashed into the commitment
+	Quant QuantConfig `gnark:"-"`
+}
+
+// NewLipschitzCircuit allocates a circuit for a model with the given shape
+func NewLipschitzCircuit(shape ModelShape, quant QuantConfig) *LipschitzCircuit {
+	shape = shape.architecture()
+	model := NewProveModelCircuit(shape, quant)
+	return &LipschitzCircuit{Tag: CircuitTag("lipschitz", shape, quant), Weights: model.Weights, Biases: model.Biases, Shape: shape, Quant: quant}
+}
+
+// NewLipschitzAssignment fills the circuit with the quantized model and the
+// claimed bound. It fails if the model's bound is above the claim or an
+// activation, as quantized, is steeper than 1.
+func NewLipschitzAssignment(m *ModelData, bound fixedpoint.Decimal) (*LipschitzCircuit, error) {
+	shape, err := m.Shape()
+	if err != nil {
+		return nil, err
+	}
+	quant := m.Quant()
+	if err := shape.CheckOneLipschitz(quant); err != nil {
+		return nil, err
+	}
+	weights, biases, err := m.Quantize()
+	if err != nil {
+		return nil, err
+	}
+	assignment := NewLipschitzCircuit(shape, quant)
+	for layer := range weights {
+		for neuron := range weights[layer] {
+			for j := range weights[layer][neuron] {
+				assignment.Weights[layer][neuron][j] = weights[layer][neuron][j].Variable()
+			}
+			assignment.Biases[layer][neuron] = biases[layer][neuron].Variable()
+		}
+	}
+	assignment.Commitment = ModelDigest(shape, quant, weights, biases)
+
+	// rounded down, so the proven bound is never above the one asked for
+	claim, err := fixedpoint.Quantize(bound, fixedpoint.Scale, fixedpoint.Floor)
+	if err != nil {
+		return nil, err
+	}
+	if got := lipschitzBound(weights); got.Cmp(claim) > 0 {
+		return nil, fmt.Errorf("the model's Lipschitz bound is %s, above %s", got.Decimal(), bound)
+	}
+	assignment.Bound = claim.Variable()
+	return assignment, nil
+}
+
+// CheckOneLipschitz returns an error unless every activation of the shape is
+// 1-Lipschitz as quantized with quant, which the bound relies on. The prover
+// checks it before proving and the verifier again on the shape it trusts.
+func (s ModelShape) CheckOneLipschitz(quant QuantConfig) error {
+	plan, err := s.plan()
+	if err != nil {
+		return err
+	}
+	for i, p := range plan {
+		if p.Param >= 0 && !p.activationFn(quant.ActivationScale.At(p.Param)).oneLipschitz(quant.Rescale) {
+			return fmt.Errorf("layer %d: %s isn't 1-Lipschitz at this scale, the bound doesn't cover it", i, p.activation())
+		}
+	}
+	return nil
+}
+
+// lipschitzBound is the host-side twin of the product Define computes
+func lipschitzBound(weights [][][]fixedpoint.Value) fixedpoint.Value {
+	product := fixedpoint.NewValue(fixedpoint.Scale, fixedpoint.Scale)
+	for layer := range weights {
+		var norm fixedpoint.Value
+		for i := range weights[layer] {
+			sum := fixedpoint.NewValue(0, weights[layer][i][0].Scale)
+			for _, w := range weights[layer][i] {
+				if w.IsNegative() {
+					w = fixedpoint.NewValue(0, w.Scale).Sub(w)
+				}
+				sum = sum.Add(w)
+			}
+			if i == 0 || sum.Cmp(norm) > 0 {
+				norm = sum
+			}
+		}
+		product = product.Mul(norm).Rescale(fixedpoint.Scale, fixedpoint.Ceil)
+	}
+	return product
+}
+
+func (circuit *LipschitzCircuit) Define(api frontend.API) error {
+	fp := fixedpoint.NewAPI(api)
+	api.AssertIsEqual(circuit.Tag, CircuitTag("lipschitz", circuit.Shape, circuit.Quant))
+	if err := assertCommitment(api, circuit.Shape, circuit.Quant, circuit.Weights, circuit.Biases, circuit.Commitment); err != nil {
+		return err
+	}
+
+	// bounding the weights keeps the row sums and the product from wrapping around the field
+	nbBits := fixedpoint.ValueBits(api) / 2
+	product := fixedpoint.New(fixedpoint.Scale, fixedpoint.Scale)
+	for layer := range circuit.Weights {
+		weightScale := circuit.Quant.WeightScale.At(layer)
+		var norm fixedpoint.Fixed
+		for i := range circuit.Weights[layer] {
+			sum := fixedpoint.New(0, weightScale)
+			for j := range circuit.Weights[layer][i] {
+				w := fixedpoint.New(circuit.Weights[layer][i][j], weightScale)
+				fp.AssertSignedBits(w, nbBits)
+				sum = fp.Add(sum, fp.Select(fp.IsNegative(w), fp.Sub(fixedpoint.New(0, weightScale), w), w))
+			}
+			if i == 0 {
+				norm = sum
+			} else {
+				norm = fp.Select(fp.IsLess(norm, sum), sum, norm)
+			}
+		}
+		// rounding up keeps the product an upper bound
+		product = fp.Rescale(fp.Mul(product, norm), fixedpoint.Scale, fixedpoint.Ceil)
+	}
+
+	api.AssertIsEqual(fp.IsLess(fixedpoint.New(circuit.Bound, fixedpoint.Scale), product), 0)
+	return nil
+}
+
+// LipschitzMetadata is written next to a Lipschitz proof
+type LipschitzMetadata struct {
+	Shape        ModelShape         `json:"shape"`
+	Quantization QuantConfig        `json:"quantization"`
+	Commitment   string             `json:"commitment"`
+	Bound        fixedpoint.Decimal `json:"bound"`
+	Setup        string             `json:"setup,omitempty"` // SetupID of the keys, see proofsystem.CheckSetup
+}
+
+// NewLipschitzMetadata describes the public values of a filled in Lipschitz
+// circuit, the bound being the claim as rounded down into the circuit
+func NewLipschitzMetadata(shape ModelShape, quant QuantConfig, assignment *LipschitzCircuit) LipschitzMetadata {
+	return LipschitzMetadata{
+		Shape:        shape,
+		Quantization: quant,
+		Commitment:   fmt.Sprint(assignment.Commitment),
+		Bound:        fixedpoint.Value{V: assignment.Bound.(*big.Int), Scale: fixedpoint.Scale}.Decimal(),
+	}
+}
+
+// LoadLipschitzMetadata reads the metadata written next to a Lipschitz proof
+func LoadLipschitzMetadata(path string) (*LipschitzMetadata, error) {
+	var meta LipschitzMetadata
+	if err := readJSON(path, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// LipschitzPublicAssignment rebuilds the public part of the assignment a
+// Lipschitz proof was made with from its metadata. It fails if an activation
+// of the shape isn't 1-Lipschitz, since the circuit doesn't check them; the
+// public CircuitTag makes sure the shape checked is the one of the key.
+func LipschitzPublicAssignment(meta *LipschitzMetadata) (*LipschitzCircuit, error) {
+	if err := meta.Shape.CheckOneLipschitz(meta.Quantization); err != nil {
+		return nil, err
+	}
+	commitment, ok := new(big.Int).SetString(meta.Commitment, 10)
+	if !ok {
+		return nil, fmt.Errorf("commitment %q is not a number", meta.Commitment)
+	}
+	bound, err := fixedpoint.Quantize(meta.Bound, fixedpoint.Scale, fixedpoint.Exact)
+	if err != nil {
+		return nil, fmt.Errorf("bound: %w", err)
+	}
+	return &LipschitzCircuit{Tag: CircuitTag("lipschitz", meta.Shape, meta.Quantization), Commitment: commitment, Bound: bound.Variable()}, nil
+}
+
+// LipschitzClaim reads the model commitment and the bound out of the public
+// witness of a Lipschitz proof
+func LipschitzClaim(publicWitness witness.Witness) (commitment string, bound fixedpoint.Decimal, err error) {
+	vector, ok := publicWitness.Vector().(fr.Vector)
+	if !ok || len(vector) != 3 {
+		return "", bound, fmt.Errorf("the public witness isn't a Lipschitz proof's tag, commitment and bound")
+	}
+	var v big.Int
+	vector[2].BigInt(&v)
+	return vector[1].String(), fixedpoint.Value{V: &v, Scale: fixedpoint.Scale}.Decimal(), nil
+}
+
+// LipschitzProof is a checked proof of a Lipschitz bound with what a verifier
+// needs to check it again
+type LipschitzProof struct {
+	Meta          LipschitzMetadata
+	VK            proofsystem.VerifyingKey
+	Proof         proofsystem.Proof
+	PublicWitness witness.Witness
+}
+
+// ProveLipschitz proves that the model's Lipschitz bound is at most bound and
+// checks the proof. The keys come from store, so every model of one shape is
+// proven with the same ones.
+func ProveLipschitz(store KeyStore, m *ModelData, bound fixedpoint.Decimal) (*LipschitzProof, error) {
+	shape, err := m.Shape()
+	if err != nil {
+		return nil, err
+	}
+	assignment, err := NewLipschitzAssignment(m, bound)
+	if err != nil {
+		return nil, err
+	}
+
+	backend := store.ProofSystem()
+	cs, pk, vk, err := store.Setup(CircuitID("lipschitz", backend.Name(), shape, m.Quant()), NewLipschitzCircuit(shape, m.Quant()))
+	if err != nil {
+		return nil, err
+	}
+	full, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, fmt.Errorf("creating witness: %w", err)
+	}
+	proof, err := backend.Prove(cs, pk, full)
+	if err != nil {
+		return nil, fmt.Errorf("proving: %w", err)
+	}
+	publicWitness, err := full.Public()
+	if err != nil {
+		return nil, err
+	}
+	if err := backend.Verify(proof, vk, publicWitness); err != nil {
+		return nil, fmt.Errorf("verification failed: %w", err)
+	}
+	meta := NewLipschitzMetadata(shape, m.Quant(), assignment)
+	if meta.Setup, err = backend.SetupID(); err != nil {
+		return nil, err
+	}
+	return &LipschitzProof{Meta: meta, VK: vk, Proof: proof, PublicWitness: publicWitness}, nil
+}
@@ -0,0 +1,113 @@
+package nn
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/lookup/logderivlookup"
+
+	"sudokuChecker/fixedpoint"
+)
+
+// maxTableEntries bounds the size of one activation table, each entry costs
+// about one constraint
+const maxTableEntries = 1 << 20
+
+// ActivationTable is the optional "activationTable" section of weights.json.
+// With it every activation is read from a table holding its value for each
+// fixed-point number in [Min, Max], checked with gnark's log-derivative lookup
+// argument, instead of being computed with comparisons that each decompose
+// their input into bits. The table costs about one constraint per entry and a
+// few per lookup, so it pays off when there are many activations. A lookup
+// also proves its input lies in [Min, Max], so an activation outside the
+// table makes the proof fail.
+//
+// The table is what allows activations without a cheap circuit, such as
+// sigmoid, tanh and GELU, which are rounded to the nearest fixed-point step.
+type ActivationTable struct {
+	Min fixedpoint.Decimal `json:"min"` // smallest rescaled sum an activation can be given
+	Max fixedpoint.Decimal `json:"max"` // largest rescaled sum an activation can be given
+}
+
+// domain returns the range of the table at the given scale, rounded inwards
+func (t *ActivationTable) domain(scale int64) (lo, hi fixedpoint.Value) {
+	lo, _ = fixedpoint.Quantize(t.Min, scale, fixedpoint.Ceil)
+	hi, _ = fixedpoint.Quantize(t.Max, scale, fixedpoint.Floor)
+	return lo, hi
+}
+
+// checkTable validates the table against every layer's output scale
+func (s ModelShape) checkTable(quant QuantConfig) error {
+	if s.Table == nil {
+		return nil
+	}
+	if s.Table.Min.Rat().Cmp(s.Table.Max.Rat()) >= 0 {
+		return fmt.Errorf("activation table range [%s, %s] is empty", s.Table.Min, s.Table.Max)
+	}
+	for layer := range s.LayerSizes {
+		lo, hi := s.Table.domain(quant.ActivationScale.At(layer))
+		if size := hi.Sub(lo).V; size.Sign() < 0 {
+			return fmt.Errorf("activation table range [%s, %s] holds no value at layer %d's scale", s.Table.Min, s.Table.Max, layer)
+		} else if !size.IsInt64() || size.Int64() >= maxTableEntries {
+			return fmt.Errorf("the activation table of layer %d would have %v entries, more than %d", layer, size, maxTableEntries)
+		}
+	}
+	return nil
+}
+
+// activationTables builds each distinct activation table of a circuit once
+// and shares it between the layers and inputs using it
+type activationTables struct {
+	api    frontend.API
+	tables map[string]*logderivlookup.Table
+}
+
+func newActivationTables(api frontend.API) *activationTables {
+	return &activationTables{api: api, tables: map[string]*logderivlookup.Table{}}
+}
+
+// lookup returns a applied to v, the activation's input at its output scale
+func (t *activationTables) lookup(a activationFn, v fixedpoint.Fixed, mode fixedpoint.Rounding) fixedpoint.Fixed {
+	key := fmt.Sprint(a.Kind, a.Slope, a.Lo, a.Hi, a.Offset, a.TableLo, a.TableHi, mode)
+	table, ok := t.tables[key]
+	if !ok {
+		table = logderivlookup.New(t.api)
+		for x := a.TableLo.V.Int64(); x <= a.TableHi.V.Int64(); x++ {
+			table.Insert(a.apply(fixedpoint.NewValue(x, v.Scale), mode).Variable())
+		}
+		t.tables[key] = table
+	}
+	return fixedpoint.New(table.Lookup(t.api.Sub(v.V, a.TableLo.Variable()))[0], v.Scale)
+}
+
+// activate applies a to v with the table when the model has one and with
+// comparisons otherwise
+func (circuit *ProveModelCircuit) activate(api frontend.API, fp *fixedpoint.API, a activationFn, v fixedpoint.Fixed, mode fixedpoint.Rounding) fixedpoint.Fixed {
+	if !a.Tabled {
+		return a.define(fp, v, mode)
+	}
+	if circuit.tables == nil {
+		circuit.tables = newActivationTables(api)
+	}
+	return circuit.tables.lookup(a, v, mode)
+}
+
+// checkTableDomain returns an error if an activation of the trace falls
+// outside the activation table, which would make the lookup fail
+func checkTableDomain(plan []layerPlan, trace []layerTrace, quant QuantConfig) error {
+	for layer, p := range plan {
+		if p.Param < 0 {
+			continue
+		}
+		a := p.activationFn(quant.ActivationScale.At(p.Param))
+		if !a.Tabled {
+			continue
+		}
+		for i, v := range trace[layer].Sums {
+			if v.Cmp(a.TableLo) < 0 || v.Cmp(a.TableHi) > 0 {
+				return fmt.Errorf("layer %d neuron %d reaches %v, outside the activation table [%v, %v]", layer, i, v.Float(), a.TableLo.Float(), a.TableHi.Float())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package nn
+
+import (
+	"github.com/consensys/gnark/frontend"
+
+	"sudokuChecker/fixedpoint"
+)
+
+// LogitMargin requires the winning output of every input to beat every other
+// output by at least Delta. A bare argmax treats a win by 0.001 the same as a
+// win by 10, the margin tells how confident the model is.
+type LogitMargin struct {
+	Delta frontend.Variable `gnark:",public"` // at the activation scale of the last layer
+}
+
+// MarginReport exposes the smallest margin any input won by
+type MarginReport struct {
+	Smallest frontend.Variable `gnark:",public"` // at the activation scale of the last layer
+}
+
+// argmaxMargin is argmax that also returns by how much the largest output
+// beats the runner-up, zero on ties. It needs at least two outputs.
+func argmaxMargin(api frontend.API, fp *fixedpoint.API, outputs []fixedpoint.Fixed) (frontend.Variable, fixedpoint.Fixed) {
+	isLess := fp.IsLess(outputs[0], outputs[1])
+	maxVal := fp.Select(isLess, outputs[1], outputs[0])
+	second := fp.Select(isLess, outputs[0], outputs[1])
+	maxIdx := api.Select(isLess, frontend.Variable(1), frontend.Variable(0))
+	for i := 2; i < len(outputs); i++ {
+		isLess = fp.IsLess(maxVal, outputs[i])
+		// a new maximum pushes the old one down, anything else may still beat the runner-up
+		runnerUp := fp.Select(fp.IsLess(second, outputs[i]), outputs[i], second)
+		second = fp.Select(isLess, maxVal, runnerUp)
+		maxVal = fp.Select(isLess, outputs[i], maxVal)
+		maxIdx = api.Select(isLess, frontend.Variable(i), maxIdx)
+	}
+	return maxIdx, fp.Sub(maxVal, second)
+}
+
+// margin is the host-side twin of argmaxMargin's margin
+func margin(outputs []fixedpoint.Value) fixedpoint.Value {
+	maxVal, second := outputs[0], outputs[1]
+	if maxVal.Cmp(second) < 0 {
+		maxVal, second = second, maxVal
+	}
+	for _, v := range outputs[2:] {
+		if v.Cmp(maxVal) > 0 {
+			maxVal, second = v, maxVal
+		} else if v.Cmp(second) > 0 {
+			second = v
+		}
+	}
+	return maxVal.Sub(second)
+}
@@ -0,0 +1,451 @@
+package nn
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	"sudokuChecker/fixedpoint"
+)
+
+// ModelShape describes the dimensions of a ProveModelCircuit. It is read from
+// the weights and inputs files so the circuit no longer has to be edited by
+// hand for every network size.
+type ModelShape struct {
+	InputSize    int   `json:"inputSize"`              // width of every input vector
+	LayerSizes   []int `json:"layerSizes"`             // number of neurons in each layer, in order
+	BatchSize    int   `json:"batchSize"`              // number of input vectors proven together
+	Ball         Norm  `json:"ball,omitempty"`         // norm of the public ball every input is checked against, empty for none
+	Certify      bool  `json:"certify,omitempty"`      // whether the circuit also certifies a public box
+	SameLabel    bool  `json:"sameLabel,omitempty"`    // whether all inputs and the ball center share a public label
+	Margin       bool  `json:"margin,omitempty"`       // whether every input has to win by a public margin
+	ReportMargin bool  `json:"reportMargin,omitempty"` // whether the smallest margin is a public output
+
+	Input  *Tensor          `json:"input,omitempty"`           // shape of the input images, nil for plain vectors
+	Layers []Layer          `json:"layers,omitempty"`          // nil when every weight layer is dense
+	Table  *ActivationTable `json:"activationTable,omitempty"` // nil when activations are computed with comparisons
+}
+
+// OutputSize returns the width of the final layer.
+func (s ModelShape) OutputSize() int {
+	if s.Layers != nil {
+		if plan, err := s.plan(); err == nil && len(plan) > 0 {
+			return outputSize(plan)
+		}
+	}
+	if len(s.LayerSizes) == 0 {
+		return s.InputSize
+	}
+	return s.LayerSizes[len(s.LayerSizes)-1]
+}
+
+// QuantConfig is the optional "quantization" section of weights.json. It
+// decides how the real-valued files are turned into the integers the circuit
+// works on. Scales can be decimal (1000, "10^3") or powers of two ("2^10"),
+// and the weight and activation scales can be given per layer as a list.
+type QuantConfig struct {
+	InputScale      fixedpoint.Factor   `json:"inputScale"`      // scale of the input vectors
+	WeightScale     fixedpoint.Factors  `json:"weightScale"`     // scale of each layer's weights
+	ActivationScale fixedpoint.Factors  `json:"activationScale"` // scale of each layer's outputs
+	Rounding        fixedpoint.Rounding `json:"rounding"`        // rounding when quantizing the files
+	Rescale         fixedpoint.Rounding `json:"rescale"`         // rounding when the circuit rescales a layer
+}
+
+// DefaultQuantConfig is used when weights.json has no quantization section:
+// everything is scaled by 1000, values in the files must be exact multiples
+// of their scale and layers are floored.
+func DefaultQuantConfig() QuantConfig {
+	return QuantConfig{
+		InputScale:      fixedpoint.Scale,
+		WeightScale:     fixedpoint.Factors{fixedpoint.Scale},
+		ActivationScale: fixedpoint.Factors{fixedpoint.Scale},
+		Rounding:        fixedpoint.Exact,
+		Rescale:         fixedpoint.Floor,
+	}
+}
+
+// LayerInputScale returns the scale of the values entering layer
+func (q QuantConfig) LayerInputScale(layer int) int64 {
+	if layer == 0 {
+		return int64(q.InputScale)
+	}
+	return q.ActivationScale.At(layer - 1)
+}
+
+// BiasScale returns the scale of layer's biases. Biases are added to the
+// weighted sum, so they use the product of the weight and input scales.
+func (q QuantConfig) BiasScale(layer int) int64 {
+	return q.WeightScale.At(layer) * q.LayerInputScale(layer)
+}
+
+// Validate checks the config against a model with nbLayers layers
+func (q QuantConfig) Validate(nbLayers int) error {
+	if q.InputScale <= 0 {
+		return fmt.Errorf("input scale must be positive")
+	}
+	for name, f := range map[string]fixedpoint.Factors{"weight": q.WeightScale, "activation": q.ActivationScale} {
+		if len(f) != 1 && len(f) != nbLayers {
+			return fmt.Errorf("got %d %s scales for %d layers", len(f), name, nbLayers)
+		}
+		for _, v := range f {
+			if v <= 0 {
+				return fmt.Errorf("%s scales must be positive", name)
+			}
+		}
+	}
+	if err := q.Rounding.Validate(); err != nil {
+		return err
+	}
+	if err := q.Rescale.Validate(); err != nil {
+		return err
+	}
+	if q.Rescale == fixedpoint.Exact {
+		return fmt.Errorf("layers can't be rescaled with %q rounding", fixedpoint.Exact)
+	}
+	for layer := 0; layer < nbLayers; layer++ {
+		// the sums are at the product of the scales, which has to fit in an int64
+		if weight, in := q.WeightScale.At(layer), q.LayerInputScale(layer); weight > math.MaxInt64/in {
+			return fmt.Errorf("layer %d sums at scale %d*%d, which overflows an int64", layer, weight, in)
+		}
+		acc, out := q.BiasScale(layer), q.ActivationScale.At(layer)
+		if acc%out != 0 {
+			return fmt.Errorf("layer %d sums at scale %d, which can't be rescaled to %d", layer, acc, out)
+		}
+	}
+	return nil
+}
+
+// ModelData holds the raw contents of weights.json. Numbers are kept as exact
+// decimals and only turned into integers by NewAssignment.
+type ModelData struct {
+	Input        *Tensor                  `json:"input,omitempty"`  // needed when the first layer is a convolution
+	Layers       []Layer                  `json:"layers,omitempty"` // all dense when not given
+	Weights      [][][]fixedpoint.Decimal `json:"weights"`
+	Biases       [][]fixedpoint.Decimal   `json:"biases"`
+	Quantization *QuantConfig             `json:"quantization,omitempty"`
+
+	ActivationTable *ActivationTable `json:"activationTable,omitempty"` // evaluate activations with lookups
+}
+
+// Quant returns the model's quantization config, or the default if it has none
+func (m *ModelData) Quant() QuantConfig {
+	if m.Quantization == nil {
+		return DefaultQuantConfig()
+	}
+	return *m.Quantization
+}
+
+// Quantize converts the weights and biases to fixed point with the model's
+// scales and rounding mode.
+func (m *ModelData) Quantize() (weights [][][]fixedpoint.Value, biases [][]fixedpoint.Value, err error) {
+	quant := m.Quant()
+	weights = make([][][]fixedpoint.Value, len(m.Weights))
+	biases = make([][]fixedpoint.Value, len(m.Biases))
+	for layer := range m.Weights {
+		weightScale, biasScale := quant.WeightScale.At(layer), quant.BiasScale(layer)
+		weights[layer] = make([][]fixedpoint.Value, len(m.Weights[layer]))
+		biases[layer] = make([]fixedpoint.Value, len(m.Biases[layer]))
+		for neuron := range m.Weights[layer] {
+			weights[layer][neuron] = make([]fixedpoint.Value, len(m.Weights[layer][neuron]))
+			for j := range m.Weights[layer][neuron] {
+				weights[layer][neuron][j], err = fixedpoint.Quantize(m.Weights[layer][neuron][j], weightScale, quant.Rounding)
+				if err != nil {
+					return nil, nil, fmt.Errorf("weight %d of layer %d neuron %d: %w", j, layer, neuron, err)
+				}
+			}
+
+			biases[layer][neuron], err = fixedpoint.Quantize(m.Biases[layer][neuron], biasScale, quant.Rounding)
+			if err != nil {
+				return nil, nil, fmt.Errorf("bias of layer %d neuron %d: %w", layer, neuron, err)
+			}
+		}
+	}
+	return weights, biases, nil
+}
+
+// InputData holds the raw contents of inputs.json
+type InputData struct {
+	Inputs [][]fixedpoint.Decimal `json:"inputs"`
+}
+
+// ExpectedData holds the raw contents of outputs.json
+type ExpectedData struct {
+	Expected []int `json:"outputs"`
+}
+
+// BallData holds initialPoint.json, the ball Generate_Input samples the
+// inputs from. Its center and radius become public inputs of the circuit.
+type BallData struct {
+	Center []fixedpoint.Decimal `json:"initialPoint"`
+	Radius fixedpoint.Decimal   `json:"boundry"`
+	Norm   Norm                 `json:"norm,omitempty"` // L2 when not set
+}
+
+// CertifyData holds the box to certify. It uses the initialPoint.json format,
+// with the radius as the half width of the box, plus the class to certify.
+type CertifyData struct {
+	Center  []fixedpoint.Decimal `json:"initialPoint"`
+	Epsilon fixedpoint.Decimal   `json:"boundry"`
+	Label   int                  `json:"label"`
+}
+
+// ProverData is everything the prover reads from disk
+type ProverData struct {
+	Model    *ModelData
+	Inputs   *InputData
+	Expected *ExpectedData
+	Ball     *BallData    // nil unless the inputs are checked against a ball
+	Certify  *CertifyData // nil unless a box is certified
+
+	// SameLabel replaces the private expected outputs by one public label, the
+	// class every input and the ball center get. It needs a ball.
+	SameLabel bool
+
+	Margin       *fixedpoint.Decimal // nil unless the inputs have to win by a public margin
+	ReportMargin bool                // publish the smallest margin the inputs won by
+
+	// InputBound widens the inputs the overflow analysis covers to at least
+	// [-InputBound, InputBound] in every coordinate. Nil to only cover the
+	// inputs, the ball and the certified box.
+	InputBound *fixedpoint.Decimal
+}
+
+func readJSON(path string, v interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return nil
+}
+
+// WriteJSON writes v to path as indented JSON
+func WriteJSON(path string, v interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// LoadModel reads a weights file and checks that every layer is well formed
+func LoadModel(path string) (*ModelData, error) {
+	// fields missing from the quantization section keep their defaults
+	quant := DefaultQuantConfig()
+	m := ModelData{Quantization: &quant}
+	if err := readJSON(path, &m); err != nil {
+		return nil, err
+	}
+	shape, err := m.Shape()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := m.Quant().Validate(len(shape.LayerSizes)); err != nil {
+		return nil, fmt.Errorf("%s: quantization: %w", path, err)
+	}
+	return &m, nil
+}
+
+// LoadInputs reads an inputs file and checks that all vectors have the same width
+func LoadInputs(path string) (*InputData, error) {
+	var in InputData
+	if err := readJSON(path, &in); err != nil {
+		return nil, err
+	}
+	if len(in.Inputs) == 0 {
+		return nil, fmt.Errorf("%s: no input vectors", path)
+	}
+	for i := range in.Inputs {
+		if len(in.Inputs[i]) != len(in.Inputs[0]) {
+			return nil, fmt.Errorf("%s: input %d has %d values, expected %d", path, i, len(in.Inputs[i]), len(in.Inputs[0]))
+		}
+	}
+	return &in, nil
+}
+
+// LoadExpected reads an outputs file
+func LoadExpected(path string) (*ExpectedData, error) {
+	var out ExpectedData
+	if err := readJSON(path, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LoadBall reads an initialPoint.json file
+func LoadBall(path string) (*BallData, error) {
+	var b BallData
+	if err := readJSON(path, &b); err != nil {
+		return nil, err
+	}
+	if b.Radius.Rat().Sign() < 0 {
+		return nil, fmt.Errorf("%s: radius %s is negative", path, b.Radius)
+	}
+	if b.Norm == "" {
+		b.Norm = L2
+	}
+	if err := b.Norm.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &b, nil
+}
+
+// LoadCertify reads the box to certify
+func LoadCertify(path string) (*CertifyData, error) {
+	c := CertifyData{Label: -1}
+	if err := readJSON(path, &c); err != nil {
+		return nil, err
+	}
+	if c.Label < 0 {
+		return nil, fmt.Errorf("%s: missing the label to certify", path)
+	}
+	if c.Epsilon.Rat().Sign() < 0 {
+		return nil, fmt.Errorf("%s: epsilon %s is negative", path, c.Epsilon)
+	}
+	return &c, nil
+}
+
+// Shape returns the layer widths of the model. Layer i must take exactly as
+// many inputs as layer i-1 has neurons, and every layer needs one bias per neuron.
+// With a "layers" section the weight rows must instead fit the tensors the
+// layers produce, a conv2d row holding one weight per input channel and kernel cell.
+func (m *ModelData) Shape() (ModelShape, error) {
+	var shape ModelShape
+	if len(m.Weights) == 0 {
+		return shape, fmt.Errorf("model has no layers")
+	}
+	if len(m.Biases) != len(m.Weights) {
+		return shape, fmt.Errorf("model has %d weight layers but %d bias layers", len(m.Weights), len(m.Biases))
+	}
+
+	for layer := range m.Weights {
+		neurons := len(m.Weights[layer])
+		if neurons == 0 {
+			return shape, fmt.Errorf("layer %d has no neurons", layer)
+		}
+		fanIn := len(m.Weights[layer][0])
+		if fanIn == 0 {
+			return shape, fmt.Errorf("layer %d has no inputs", layer)
+		}
+		for i := range m.Weights[layer] {
+			if len(m.Weights[layer][i]) != fanIn {
+				return shape, fmt.Errorf("layer %d neuron %d has %d weights, expected %d", layer, i, len(m.Weights[layer][i]), fanIn)
+			}
+		}
+		if len(m.Biases[layer]) != neurons {
+			return shape, fmt.Errorf("layer %d has %d neurons but %d biases", layer, neurons, len(m.Biases[layer]))
+		}
+
+		if layer == 0 {
+			shape.InputSize = fanIn
+		} else if prev := shape.LayerSizes[layer-1]; fanIn != prev && m.Layers == nil {
+			return shape, fmt.Errorf("layer %d expects %d inputs but layer %d has %d neurons", layer, fanIn, layer-1, prev)
+		}
+		shape.LayerSizes = append(shape.LayerSizes, neurons)
+	}
+	shape.Table = m.ActivationTable
+	if m.Layers == nil && m.Input == nil {
+		return shape, shape.checkTable(m.Quant())
+	}
+
+	shape.Input, shape.Layers = m.Input, m.Layers
+	if m.Input != nil {
+		shape.InputSize = m.Input.Size()
+	} else if m.Layers[0].Type != Dense {
+		return shape, fmt.Errorf("a model starting with a %s layer needs an input shape", m.Layers[0].Type)
+	}
+	plan, err := shape.plan()
+	if err != nil {
+		return shape, err
+	}
+	for i, p := range plan {
+		if p.Param >= 0 && len(m.Weights[p.Param][0]) != p.FanIn {
+			return shape, fmt.Errorf("layer %d has %d weights per row, but its %v input needs %d", i, len(m.Weights[p.Param][0]), p.In, p.FanIn)
+		}
+	}
+	return shape, shape.checkTable(m.Quant())
+}
+
+// CircuitShape combines the model, inputs, expected outputs, ball and box into the
+// shape of the circuit, rejecting files that don't agree with each other and
+// models whose sums could wrap around the field for those inputs.
+func CircuitShape(d *ProverData) (ModelShape, error) {
+	shape, err := d.Model.Shape()
+	if err != nil {
+		return shape, err
+	}
+	if w := len(d.Inputs.Inputs[0]); w != shape.InputSize {
+		return shape, fmt.Errorf("inputs have %d values but the model expects %d", w, shape.InputSize)
+	}
+	shape.BatchSize = len(d.Inputs.Inputs)
+
+	if len(d.Expected.Expected) != shape.BatchSize {
+		return shape, fmt.Errorf("got %d expected outputs for %d inputs", len(d.Expected.Expected), shape.BatchSize)
+	}
+	for i, label := range d.Expected.Expected {
+		if label < 0 || label >= shape.OutputSize() {
+			return shape, fmt.Errorf("expected output %d is %v, not a class in [0, %d)", i, label, shape.OutputSize())
+		}
+	}
+
+	if d.Ball != nil {
+		if w := len(d.Ball.Center); w != shape.InputSize {
+			return shape, fmt.Errorf("ball center has %d values but the model expects %d", w, shape.InputSize)
+		}
+		shape.Ball = d.Ball.Norm
+		if shape.Ball == "" {
+			shape.Ball = L2
+		}
+		if err := shape.Ball.Validate(); err != nil {
+			return shape, err
+		}
+	}
+
+	if d.SameLabel {
+		if d.Ball == nil {
+			return shape, fmt.Errorf("the same-label statement needs a ball center")
+		}
+		for i, label := range d.Expected.Expected {
+			if label != d.Expected.Expected[0] {
+				return shape, fmt.Errorf("expected output %d is %d, but the same-label statement needs every input to be %d", i, label, d.Expected.Expected[0])
+			}
+		}
+		shape.SameLabel = true
+	}
+
+	if d.Margin != nil || d.ReportMargin {
+		if shape.OutputSize() < 2 {
+			return shape, fmt.Errorf("a margin needs at least two outputs, the model has %d", shape.OutputSize())
+		}
+		if d.Margin != nil && d.Margin.Rat().Sign() < 0 {
+			return shape, fmt.Errorf("margin %s is negative", d.Margin)
+		}
+		shape.Margin = d.Margin != nil
+		shape.ReportMargin = d.ReportMargin
+	}
+
+	if d.Certify != nil {
+		if w := len(d.Certify.Center); w != shape.InputSize {
+			return shape, fmt.Errorf("certified box center has %d values but the model expects %d", w, shape.InputSize)
+		}
+		if d.Certify.Label < 0 || d.Certify.Label >= shape.OutputSize() {
+			return shape, fmt.Errorf("certified label %d is not a class in [0, %d)", d.Certify.Label, shape.OutputSize())
+		}
+		for i, l := range shape.Layers {
+			if !l.activation().monotone() {
+				return shape, fmt.Errorf("layer %d: interval bounds can't pass through %s, which isn't monotone", i, l.activation())
+			}
+		}
+		shape.Certify = true
+	}
+	return shape, d.checkOverflow()
+}
@@ -0,0 +1,49 @@
+package nn
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark/test"
+)
+
+func TestLoadRejectsMalformedFiles(t *testing.T) {
+	const weights = `{"weights": [[[0.1, 0.75, 0.06], [0.77, -0.03, 0.32]]], "biases": [[-0.13, 0.21]]}`
+	for _, tc := range []struct {
+		name, weights, inputs, contains string
+	}{
+		{"ragged row", `{"weights": [[[0.1, 0.75, 0.06], [0.77, -0.03]]], "biases": [[-0.13, 0.21]]}`, `{"inputs": [[1, 2, 3]]}`, "neuron 1 has 2 weights, expected 3"},
+		{"bias length", `{"weights": [[[0.1, 0.75, 0.06], [0.77, -0.03, 0.32]]], "biases": [[-0.13]]}`, `{"inputs": [[1, 2, 3]]}`, "2 neurons but 1 biases"},
+		{"bias layers", `{"weights": [[[0.1, 0.75, 0.06], [0.77, -0.03, 0.32]]], "biases": []}`, `{"inputs": [[1, 2, 3]]}`, "1 weight layers but 0 bias layers"},
+		{"layer widths", `{"weights": [[[0.1, 0.75, 0.06], [0.77, -0.03, 0.32]], [[0.1, 0.2, 0.3]]], "biases": [[-0.13, 0.21], [0.5]]}`, `{"inputs": [[1, 2, 3]]}`, "layer 1 expects 3 inputs but layer 0 has 2 neurons"},
+		{"ragged inputs", weights, `{"inputs": [[1, 2, 3], [1, 2]]}`, "input 1 has 2 values, expected 3"},
+		{"input width", weights, `{"inputs": [[1, 2]]}`, "inputs have 2 values but the model expects 3"},
+		{"no inputs", weights, `{"inputs": []}`, "no input vectors"},
+		{"scale overflow", `{"weights": [[[0.1, 0.75, 0.06]]], "biases": [[-0.13]], "quantization": {"inputScale": "10^10", "weightScale": "10^10", "activationScale": 1000, "rounding": "floor", "rescale": "floor"}}`, `{"inputs": [[1, 2, 3]]}`, "layer 0 sums at scale 10000000000*10000000000, which overflows an int64"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := test.NewAssert(t)
+			dir := t.TempDir()
+			weightsFile, inputsFile := filepath.Join(dir, "weights.json"), filepath.Join(dir, "inputs.json")
+			assert.NoError(os.WriteFile(weightsFile, []byte(tc.weights), 0o644))
+			assert.NoError(os.WriteFile(inputsFile, []byte(tc.inputs), 0o644))
+
+			// load as the prover does, every step may be the one that refuses
+			var err error
+			assert.NotPanics(func() {
+				var m *ModelData
+				if m, err = LoadModel(weightsFile); err != nil {
+					return
+				}
+				var in *InputData
+				if in, err = LoadInputs(inputsFile); err != nil {
+					return
+				}
+				expected := &ExpectedData{Expected: make([]int, len(in.Inputs))}
+				_, err = CircuitShape(&ProverData{Model: m, Inputs: in, Expected: expected})
+			})
+			assert.ErrorContains(err, tc.contains)
+		})
+	}
+}
@@ -0,0 +1,441 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"sudokuChecker/fixedpoint"
+	"sudokuChecker/onnx"
+)
+
+// LoadONNX reads an .onnx file and converts it into a model quantized with quant
+func LoadONNX(path string, quant QuantConfig) (*ModelData, error) {
+	g, err := onnx.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ImportONNX(g, quant)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// DefaultONNXQuant is the quantization used for imported models. Trained
+// weights are arbitrary floats, so they are rounded to the nearest step.
+func DefaultONNXQuant() QuantConfig {
+	quant := DefaultQuantConfig()
+	quant.Rounding = fixedpoint.HalfUp
+	return quant
+}
+
+// ImportONNX converts a graph made of Gemm, MatMul followed by Add, Conv,
+// Relu, LeakyRelu, HardSigmoid, Clip, MaxPool, AveragePool and Flatten nodes
+// into a model. The nodes must
+// form a chain from the graph input, as exported from a sequential PyTorch or
+// Keras model. Any other operator is rejected by name.
+func ImportONNX(g *onnx.Graph, quant QuantConfig) (*ModelData, error) {
+	input, err := graphInput(g)
+	if err != nil {
+		return nil, err
+	}
+	m := &ModelData{Layers: []Layer{}, Quantization: &quant}
+	switch len(input.Dims) {
+	case 2: // batch x features
+	case 4: // batch x channels x height x width
+		m.Input = &Tensor{Channels: int(input.Dims[1]), Height: int(input.Dims[2]), Width: int(input.Dims[3])}
+	default:
+		return nil, fmt.Errorf("input %s has shape %v, expected batch x features or batch x channels x height x width", input.Name, input.Dims)
+	}
+
+	current := input.Name
+	for i := 0; i < len(g.Nodes); i++ {
+		n := g.Nodes[i]
+		if len(n.Inputs) == 0 || len(n.Outputs) == 0 || n.Inputs[0] != current {
+			return nil, fmt.Errorf("node %s (%s) doesn't take the previous node's output, only chains of layers are supported", n.Name, n.OpType)
+		}
+		current = n.Outputs[0]
+
+		switch n.OpType {
+		case "Gemm":
+			if err := importGemm(g, n, m); err != nil {
+				return nil, err
+			}
+		case "MatMul":
+			w, err := initializer(g, n, 1, 2)
+			if err != nil {
+				return nil, err
+			}
+			rows, err := transposed(w)
+			if err != nil {
+				return nil, fmt.Errorf("node %s: %w", n.Name, err)
+			}
+			biases := make([]fixedpoint.Decimal, len(rows))
+			// PyTorch exports a linear layer without Gemm as MatMul followed by Add
+			if i+1 < len(g.Nodes) && g.Nodes[i+1].OpType == "Add" && len(g.Nodes[i+1].Inputs) == 2 {
+				add := g.Nodes[i+1]
+				other := add.Inputs[1]
+				if other == current {
+					other = add.Inputs[0]
+				}
+				if b, ok := g.Initializers[other]; ok && (add.Inputs[0] == current || add.Inputs[1] == current) {
+					if len(b.Data) != len(rows) {
+						return nil, fmt.Errorf("node %s adds %d biases to %d outputs", add.Name, len(b.Data), len(rows))
+					}
+					if biases, err = decimals(b, 0, len(b.Data)); err != nil {
+						return nil, err
+					}
+					current = add.Outputs[0]
+					i++
+				}
+			}
+			m.Layers = append(m.Layers, Layer{Type: Dense, Activation: NoActivation})
+			m.Weights = append(m.Weights, rows)
+			m.Biases = append(m.Biases, biases)
+		case "Conv":
+			if err := importConv(g, n, m); err != nil {
+				return nil, err
+			}
+		case "Relu", "LeakyRelu", "HardSigmoid", "Clip":
+			activation, err := activationLayer(g, n)
+			if err != nil {
+				return nil, err
+			}
+			if err := importActivation(n, m, activation); err != nil {
+				return nil, err
+			}
+		case "MaxPool", "AveragePool":
+			layer := Layer{Type: MaxPool}
+			if n.OpType == "AveragePool" {
+				layer.Type = AvgPool
+			}
+			if err := windowAttributes(n, &layer); err != nil {
+				return nil, err
+			}
+			if layer.Padding != 0 || intAttribute(n, "ceil_mode", 0) != 0 {
+				return nil, fmt.Errorf("node %s: padded or ceil mode pooling isn't supported", n.Name)
+			}
+			m.Layers = append(m.Layers, layer)
+		case "Flatten":
+			if axis := intAttribute(n, "axis", 1); axis != 1 {
+				return nil, fmt.Errorf("node %s: only flattening from axis 1 is supported, not %d", n.Name, axis)
+			}
+			m.Layers = append(m.Layers, Layer{Type: Flatten})
+		default:
+			return nil, fmt.Errorf("node %s: unsupported operator %s", n.Name, n.OpType)
+		}
+	}
+
+	shape, err := m.Shape()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Quant().Validate(len(shape.LayerSizes)); err != nil {
+		return nil, fmt.Errorf("quantization: %w", err)
+	}
+	return m, nil
+}
+
+// graphInput returns the graph input that isn't an initializer
+func graphInput(g *onnx.Graph) (onnx.ValueInfo, error) {
+	var inputs []onnx.ValueInfo
+	for _, in := range g.Inputs {
+		if _, ok := g.Initializers[in.Name]; !ok {
+			inputs = append(inputs, in)
+		}
+	}
+	if len(inputs) != 1 {
+		return onnx.ValueInfo{}, fmt.Errorf("graph has %d inputs, expected one", len(inputs))
+	}
+	return inputs[0], nil
+}
+
+// importGemm adds the dense layer computed by alpha*A*B' + beta*C
+func importGemm(g *onnx.Graph, n onnx.Node, m *ModelData) error {
+	if floatAttribute(n, "alpha", 1) != 1 || floatAttribute(n, "beta", 1) != 1 || intAttribute(n, "transA", 0) != 0 {
+		return fmt.Errorf("node %s: only Gemm with alpha 1, beta 1 and no transA is supported", n.Name)
+	}
+	w, err := initializer(g, n, 1, 2)
+	if err != nil {
+		return err
+	}
+	var rows [][]fixedpoint.Decimal
+	if intAttribute(n, "transB", 0) != 0 {
+		// already one row per output, the PyTorch layout
+		for r := 0; r < int(w.Dims[0]); r++ {
+			row, err := decimals(w, r*int(w.Dims[1]), (r+1)*int(w.Dims[1]))
+			if err != nil {
+				return err
+			}
+			rows = append(rows, row)
+		}
+	} else if rows, err = transposed(w); err != nil {
+		return fmt.Errorf("node %s: %w", n.Name, err)
+	}
+
+	biases := make([]fixedpoint.Decimal, len(rows))
+	if len(n.Inputs) > 2 && n.Inputs[2] != "" {
+		b, err := initializer(g, n, 2, -1)
+		if err != nil {
+			return err
+		}
+		if len(b.Data) != len(rows) {
+			return fmt.Errorf("node %s has %d biases for %d outputs", n.Name, len(b.Data), len(rows))
+		}
+		if biases, err = decimals(b, 0, len(b.Data)); err != nil {
+			return err
+		}
+	}
+	m.Layers = append(m.Layers, Layer{Type: Dense, Activation: NoActivation})
+	m.Weights = append(m.Weights, rows)
+	m.Biases = append(m.Biases, biases)
+	return nil
+}
+
+// importConv adds a conv2d layer, flattening each output channel's kernel into a row
+func importConv(g *onnx.Graph, n onnx.Node, m *ModelData) error {
+	if intAttribute(n, "group", 1) != 1 {
+		return fmt.Errorf("node %s: grouped convolutions aren't supported", n.Name)
+	}
+	w, err := initializer(g, n, 1, 4)
+	if err != nil {
+		return err
+	}
+	if w.Dims[2] != w.Dims[3] {
+		return fmt.Errorf("node %s: only square kernels are supported, not %dx%d", n.Name, w.Dims[2], w.Dims[3])
+	}
+	layer := Layer{Type: Conv2D, Kernel: int(w.Dims[2]), Activation: NoActivation}
+	if err := windowAttributes(n, &layer); err != nil {
+		return err
+	}
+	if layer.Kernel != int(w.Dims[2]) {
+		return fmt.Errorf("node %s: kernel_shape doesn't match the %dx%d weights", n.Name, w.Dims[2], w.Dims[3])
+	}
+
+	fanIn := int(w.Dims[1] * w.Dims[2] * w.Dims[3])
+	var rows [][]fixedpoint.Decimal
+	for c := 0; c < int(w.Dims[0]); c++ {
+		row, err := decimals(w, c*fanIn, (c+1)*fanIn)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+	biases := make([]fixedpoint.Decimal, len(rows))
+	if len(n.Inputs) > 2 && n.Inputs[2] != "" {
+		b, err := initializer(g, n, 2, 1)
+		if err != nil {
+			return err
+		}
+		if len(b.Data) != len(rows) {
+			return fmt.Errorf("node %s has %d biases for %d channels", n.Name, len(b.Data), len(rows))
+		}
+		if biases, err = decimals(b, 0, len(b.Data)); err != nil {
+			return err
+		}
+	}
+	m.Layers = append(m.Layers, layer)
+	m.Weights = append(m.Weights, rows)
+	m.Biases = append(m.Biases, biases)
+	return nil
+}
+
+// activationLayer returns the activation an activation node applies, as the
+// fields of the layer it follows
+func activationLayer(g *onnx.Graph, n onnx.Node) (Layer, error) {
+	switch n.OpType {
+	case "LeakyRelu":
+		slope, err := decimal(float64(floatAttribute(n, "alpha", 0.01)))
+		if err != nil {
+			return Layer{}, fmt.Errorf("node %s alpha: %w", n.Name, err)
+		}
+		return Layer{Activation: LeakyReLU, Slope: &slope}, nil
+	case "HardSigmoid":
+		if beta := floatAttribute(n, "beta", 0.5); beta != 0.5 {
+			return Layer{}, fmt.Errorf("node %s: only HardSigmoid with beta 0.5 is supported, not %v", n.Name, beta)
+		}
+		slope, err := decimal(float64(floatAttribute(n, "alpha", 0.2)))
+		if err != nil {
+			return Layer{}, fmt.Errorf("node %s alpha: %w", n.Name, err)
+		}
+		return Layer{Activation: HardSigmoid, Slope: &slope}, nil
+	case "Clip":
+		// min and max are attributes before opset 11 and optional inputs from then on
+		lo, hi, err := clipRange(g, n)
+		if err != nil {
+			return Layer{}, err
+		}
+		c, err := decimal(hi)
+		if err != nil {
+			return Layer{}, fmt.Errorf("node %s max: %w", n.Name, err)
+		}
+		switch {
+		case lo == 0 && hi > 0:
+			return Layer{Activation: ClippedReLU, Cap: &c}, nil
+		case lo == -hi && hi > 0:
+			return Layer{Activation: HardTanh, Cap: &c}, nil
+		}
+		return Layer{}, fmt.Errorf("node %s: only Clip to [0, c] or [-c, c] is supported, not [%v, %v]", n.Name, lo, hi)
+	}
+	return Layer{Activation: ReLU}, nil
+}
+
+func clipRange(g *onnx.Graph, n onnx.Node) (lo, hi float64, err error) {
+	bound := func(i int, name string) (float64, error) {
+		if a, ok := n.Attributes[name]; ok {
+			return float64(a.Float), nil
+		}
+		if i >= len(n.Inputs) || n.Inputs[i] == "" {
+			return 0, fmt.Errorf("node %s: Clip without a %s isn't supported", n.Name, name)
+		}
+		t, err := initializer(g, n, i, -1)
+		if err != nil {
+			return 0, err
+		}
+		if len(t.Data) != 1 {
+			return 0, fmt.Errorf("node %s: Clip %s has to be a scalar", n.Name, name)
+		}
+		return t.Data[0], nil
+	}
+	if lo, err = bound(1, "min"); err != nil {
+		return 0, 0, err
+	}
+	hi, err = bound(2, "max")
+	return lo, hi, err
+}
+
+// importActivation sets the activation of the layer the node follows. The
+// activations are non-decreasing, so they commute with max pooling and may
+// also come after a max pool.
+func importActivation(n onnx.Node, m *ModelData, activation Layer) error {
+	i := len(m.Layers) - 1
+	for i >= 0 && m.Layers[i].Type == MaxPool {
+		i--
+	}
+	if i >= 0 && (m.Layers[i].Type == Dense || m.Layers[i].Type == Conv2D) && m.Layers[i].Activation == NoActivation {
+		m.Layers[i].Activation, m.Layers[i].Slope, m.Layers[i].Cap = activation.Activation, activation.Slope, activation.Cap
+		return nil
+	}
+	return fmt.Errorf("node %s: %s has to follow Gemm, MatMul, Add, Conv or MaxPool", n.Name, n.OpType)
+}
+
+// windowAttributes reads the kernel, stride and padding of a Conv or pooling node
+func windowAttributes(n onnx.Node, l *Layer) error {
+	square := func(name string, values []int64, count int) (int, error) {
+		if len(values) != count {
+			return 0, fmt.Errorf("node %s: expected %d values for %s, got %v", n.Name, count, name, values)
+		}
+		for _, v := range values {
+			if v != values[0] {
+				return 0, fmt.Errorf("node %s: only equal %s on every side are supported, got %v", n.Name, name, values)
+			}
+		}
+		return int(values[0]), nil
+	}
+
+	var err error
+	if a, ok := n.Attributes["kernel_shape"]; ok {
+		if l.Kernel, err = square("kernel_shape", a.Ints, 2); err != nil {
+			return err
+		}
+	} else if l.Kernel == 0 {
+		return fmt.Errorf("node %s has no kernel_shape", n.Name)
+	}
+	l.Stride = 1
+	if a, ok := n.Attributes["strides"]; ok {
+		if l.Stride, err = square("strides", a.Ints, 2); err != nil {
+			return err
+		}
+	}
+	if a, ok := n.Attributes["pads"]; ok {
+		if l.Padding, err = square("pads", a.Ints, 4); err != nil {
+			return err
+		}
+	}
+	if a, ok := n.Attributes["dilations"]; ok {
+		if d, err := square("dilations", a.Ints, 2); err != nil || d != 1 {
+			return fmt.Errorf("node %s: dilated windows aren't supported", n.Name)
+		}
+	}
+	if a, ok := n.Attributes["auto_pad"]; ok && string(a.String) != "NOTSET" && string(a.String) != "VALID" {
+		return fmt.Errorf("node %s: auto_pad %s isn't supported, export with explicit pads", n.Name, a.String)
+	}
+	return nil
+}
+
+// initializer returns the constant input i of n, checking its rank unless rank is -1
+func initializer(g *onnx.Graph, n onnx.Node, i, rank int) (*onnx.Tensor, error) {
+	if i >= len(n.Inputs) {
+		return nil, fmt.Errorf("node %s (%s) has no input %d", n.Name, n.OpType, i)
+	}
+	t, ok := g.Initializers[n.Inputs[i]]
+	if !ok {
+		return nil, fmt.Errorf("node %s (%s): input %s isn't a constant, weights must be initializers", n.Name, n.OpType, n.Inputs[i])
+	}
+	if rank >= 0 && len(t.Dims) != rank {
+		return nil, fmt.Errorf("node %s (%s): input %s has shape %v, expected %d dimensions", n.Name, n.OpType, t.Name, t.Dims, rank)
+	}
+	return t, nil
+}
+
+// transposed turns an inputs x outputs matrix into one row per output
+func transposed(w *onnx.Tensor) ([][]fixedpoint.Decimal, error) {
+	if len(w.Dims) != 2 {
+		return nil, fmt.Errorf("weights %s have shape %v, expected a matrix", w.Name, w.Dims)
+	}
+	in, out := w.Dims[0], w.Dims[1]
+	rows := make([][]fixedpoint.Decimal, out)
+	for o := int64(0); o < out; o++ {
+		rows[o] = make([]fixedpoint.Decimal, in)
+		for i := int64(0); i < in; i++ {
+			d, err := decimal(w.Data[i*out+o])
+			if err != nil {
+				return nil, fmt.Errorf("tensor %s index %d: %w", w.Name, i*out+o, err)
+			}
+			rows[o][i] = d
+		}
+	}
+	return rows, nil
+}
+
+// decimals converts the values of t from index from up to to
+func decimals(t *onnx.Tensor, from, to int) ([]fixedpoint.Decimal, error) {
+	res := make([]fixedpoint.Decimal, to-from)
+	for i := range res {
+		d, err := decimal(t.Data[from+i])
+		if err != nil {
+			return nil, fmt.Errorf("tensor %s index %d: %w", t.Name, from+i, err)
+		}
+		res[i] = d
+	}
+	return res, nil
+}
+
+// decimal returns the shortest decimal that reads back as v, so a weight
+// trained as 0.1 is quantized from 0.1 rather than from 0.100000001490116.
+// NaN and the infinities have no decimal and are refused.
+func decimal(v float64) (fixedpoint.Decimal, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fixedpoint.Decimal{}, fmt.Errorf("%v isn't a finite number", v)
+	}
+	bits := 64
+	if float64(float32(v)) == v {
+		bits = 32
+	}
+	return fixedpoint.ParseDecimal(strconv.FormatFloat(v, 'g', -1, bits))
+}
+
+func intAttribute(n onnx.Node, name string, def int64) int64 {
+	if a, ok := n.Attributes[name]; ok {
+		return a.Int
+	}
+	return def
+}
+
+func floatAttribute(n onnx.Node, name string, def float32) float32 {
+	if a, ok := n.Attributes[name]; ok {
+		return a.Float
+	}
+	return def
+}
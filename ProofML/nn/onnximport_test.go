@@ -0,0 +1,178 @@
+package nn
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/consensys/gnark/test"
+
+	"sudokuChecker/fixedpoint"
+	"sudokuChecker/onnx"
+)
+
+// testConvGraph is testConvModel as PyTorch exports it, without the final ReLU
+func testConvGraph(assert *test.Assert) *onnx.Graph {
+	var m ModelData
+	assert.NoError(json.Unmarshal([]byte(testConvModel), &m))
+	floats := func(values ...fixedpoint.Decimal) []float64 {
+		var res []float64
+		for _, v := range values {
+			res = append(res, v.Float())
+		}
+		return res
+	}
+	ints := func(values ...int64) onnx.Attribute { return onnx.Attribute{Ints: values} }
+
+	g := &onnx.Graph{
+		Initializers: map[string]*onnx.Tensor{
+			"conv.weight": {Name: "conv.weight", Dims: []int64{2, 1, 3, 3}, Data: floats(append(m.Weights[0][0], m.Weights[0][1]...)...)},
+			"conv.bias":   {Name: "conv.bias", Dims: []int64{2}, Data: floats(m.Biases[0]...)},
+			"fc.weight":   {Name: "fc.weight", Dims: []int64{3, 2}, Data: floats(append(append(m.Weights[1][0], m.Weights[1][1]...), m.Weights[1][2]...)...)},
+			"fc.bias":     {Name: "fc.bias", Dims: []int64{3}, Data: floats(m.Biases[1]...)},
+		},
+		Inputs: []onnx.ValueInfo{{Name: "image", Dims: []int64{-1, 1, 4, 4}}, {Name: "conv.weight", Dims: []int64{2, 1, 3, 3}}},
+	}
+	nodes := []onnx.Node{
+		{OpType: "Conv", Inputs: []string{"conv.weight", "conv.bias"}, Attributes: map[string]onnx.Attribute{"kernel_shape": ints(3, 3), "pads": ints(1, 1, 1, 1), "strides": ints(1, 1)}},
+		{OpType: "MaxPool", Attributes: map[string]onnx.Attribute{"kernel_shape": ints(2, 2), "strides": ints(2, 2)}},
+		{OpType: "Relu"},
+		{OpType: "AveragePool", Attributes: map[string]onnx.Attribute{"kernel_shape": ints(2, 2), "strides": ints(2, 2)}},
+		{OpType: "Flatten", Attributes: map[string]onnx.Attribute{"axis": {Int: 1}}},
+		{OpType: "Gemm", Inputs: []string{"fc.weight", "fc.bias"}, Attributes: map[string]onnx.Attribute{"transB": {Int: 1}}},
+	}
+	previous := "image"
+	for i, n := range nodes {
+		n.Name = "/" + strconv.Itoa(i)
+		n.Inputs = append([]string{previous}, n.Inputs...)
+		previous = n.Name + "_output"
+		n.Outputs = []string{previous}
+		g.Nodes = append(g.Nodes, n)
+	}
+	return g
+}
+
+func TestImportONNX(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	g := testConvGraph(assert)
+	m, err := ImportONNX(g, DefaultONNXQuant())
+	assert.NoError(err)
+	assert.Equal(&Tensor{Channels: 1, Height: 4, Width: 4}, m.Input)
+	assert.Equal([]Layer{
+		{Type: Conv2D, Kernel: 3, Stride: 1, Padding: 1, Activation: ReLU},
+		{Type: MaxPool, Kernel: 2, Stride: 2},
+		{Type: AvgPool, Kernel: 2, Stride: 2},
+		{Type: Flatten},
+		{Type: Dense, Activation: NoActivation},
+	}, m.Layers)
+
+	// float32 weights come back as the decimals they were trained as
+	var want ModelData
+	assert.NoError(json.Unmarshal([]byte(testConvModel), &want))
+	got, err := json.Marshal([]interface{}{m.Weights, m.Biases})
+	assert.NoError(err)
+	expected, err := json.Marshal([]interface{}{want.Weights, want.Biases})
+	assert.NoError(err)
+	assert.Equal(string(expected), string(got))
+
+	// the logits without a ReLU can be negative and still prove
+	m.Biases[1][2] = fixedpoint.MustDecimal("-1")
+	shape, err := m.Shape()
+	assert.NoError(err)
+	plan, err := shape.plan()
+	assert.NoError(err)
+	weights, biases, err := m.Quantize()
+	assert.NoError(err)
+	images := testImages()
+	data := &ProverData{Model: m, Inputs: &InputData{Inputs: images}, Expected: &ExpectedData{}}
+	negative := false
+	for _, image := range images {
+		input := make([]fixedpoint.Value, len(image))
+		for i := range image {
+			input[i], err = fixedpoint.Quantize(image[i], fixedpoint.Scale, fixedpoint.Exact)
+			assert.NoError(err)
+		}
+		for _, v := range forwardValues(plan, weights, biases, input, m.Quant()) {
+			negative = negative || v.IsNegative()
+		}
+		data.Expected.Expected = append(data.Expected.Expected, predict(plan, weights, biases, input, m.Quant()))
+	}
+	assert.True(negative, "no negative logit to check")
+	assert.NoError(solve(assert, data))
+}
+
+func TestImportONNXMatMul(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	// x[1x3] * W[3x2] + B, the transpose of the rows weights.json holds
+	g := &onnx.Graph{
+		Initializers: map[string]*onnx.Tensor{
+			"W": {Name: "W", Dims: []int64{3, 2}, Data: []float64{1, 2, 3, 4, 5, 6}},
+			"B": {Name: "B", Dims: []int64{2}, Data: []float64{0.5, -0.25}},
+		},
+		Inputs: []onnx.ValueInfo{{Name: "x", Dims: []int64{-1, 3}}},
+		Nodes: []onnx.Node{
+			{Name: "mm", OpType: "MatMul", Inputs: []string{"x", "W"}, Outputs: []string{"h"}},
+			{Name: "add", OpType: "Add", Inputs: []string{"B", "h"}, Outputs: []string{"y"}},
+			{Name: "relu", OpType: "Relu", Inputs: []string{"y"}, Outputs: []string{"z"}},
+		},
+	}
+	m, err := ImportONNX(g, DefaultONNXQuant())
+	assert.NoError(err)
+	got, err := json.Marshal(m)
+	assert.NoError(err)
+	assert.Contains(string(got), `"layers":[{"type":"dense","activation":"relu"}],"weights":[[[1,3,5],[2,4,6]]],"biases":[[0.5,-0.25]]`)
+
+	// Clip to [0, 6] is ReLU6
+	g.Nodes[2] = onnx.Node{Name: "relu6", OpType: "Clip", Inputs: []string{"y", "", "six"}, Outputs: []string{"z"}}
+	g.Initializers["six"] = &onnx.Tensor{Name: "six", Data: []float64{6}}
+	_, err = ImportONNX(g, DefaultONNXQuant())
+	assert.ErrorContains(err, "Clip without a min")
+	g.Nodes[2].Attributes = map[string]onnx.Attribute{"min": {Float: 0}}
+	m, err = ImportONNX(g, DefaultONNXQuant())
+	assert.NoError(err)
+	assert.Equal(ClippedReLU, m.Layers[0].Activation)
+	assert.Equal("6", m.Layers[0].Cap.String())
+
+	// unsupported operators are named
+	g.Nodes = append(g.Nodes, onnx.Node{Name: "out", OpType: "Softmax", Inputs: []string{"z"}, Outputs: []string{"p"}})
+	_, err = ImportONNX(g, DefaultONNXQuant())
+	assert.ErrorContains(err, "unsupported operator Softmax")
+
+	// a ReLU with nothing to attach to
+	g.Nodes = append(g.Nodes[:3:3], onnx.Node{Name: "again", OpType: "Relu", Inputs: []string{"z"}, Outputs: []string{"w"}})
+	_, err = ImportONNX(g, DefaultONNXQuant())
+	assert.Error(err)
+}
+
+func TestImportONNXNonFinite(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	// a diverged training run leaves NaN and infinite weights, which have no decimal
+	for _, c := range []struct {
+		tensor string
+		index  int
+		value  float64
+	}{
+		{"conv.weight", 4, math.NaN()},
+		{"conv.bias", 1, math.Inf(1)},
+		{"fc.weight", 5, math.Inf(-1)},
+	} {
+		g := testConvGraph(assert)
+		g.Initializers[c.tensor].Data[c.index] = c.value
+		assert.NotPanics(func() {
+			_, err := ImportONNX(g, DefaultONNXQuant())
+			assert.ErrorContains(err, fmt.Sprintf("tensor %s index %d: %v isn't a finite number", c.tensor, c.index, c.value))
+		})
+	}
+
+	// and neither do attributes
+	g := testConvGraph(assert)
+	g.Nodes[2].OpType = "LeakyRelu"
+	g.Nodes[2].Attributes = map[string]onnx.Attribute{"alpha": {Float: float32(math.NaN())}}
+	_, err := ImportONNX(g, DefaultONNXQuant())
+	assert.ErrorContains(err, "alpha: NaN isn't a finite number")
+}
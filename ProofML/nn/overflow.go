@@ -0,0 +1,202 @@
+package nn
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+
+	"sudokuChecker/fixedpoint"
+)
+
+// layerOverflow is the worst case of one dense or conv2d layer over a box of inputs
+type layerOverflow struct {
+	Layer     int
+	Type      LayerType
+	SumBits   int // signed bits of the largest weighted sum the circuit forms, at the bias scale
+	ValueBits int // signed bits of the largest rescaled sum the activation is given
+}
+
+// FieldHeadroom is how many bits the weighted sums can still grow before they
+// reach half the modulus and wrap around the field. The circuit does all of its
+// arithmetic modulo the field, so a sum past that silently becomes a different,
+// small number and the rescale after it proves a wrong result.
+func (o layerOverflow) FieldHeadroom(fieldBits int) int {
+	return fieldBits - 1 - o.SumBits
+}
+
+// RangeHeadroom is how many bits the rescaled sums can still grow before the
+// range checks of the rescale and the activation reject them. Going past it
+// doesn't wrap but makes the proof fail.
+func (o layerOverflow) RangeHeadroom(fieldBits int) int {
+	return fixedpoint.FieldValueBits(fieldBits) - o.ValueBits
+}
+
+// signedBits returns the bits a signed number of magnitude |v| needs
+func signedBits(v *big.Int) int {
+	return new(big.Int).Abs(v).BitLen() + 1
+}
+
+// analyzeOverflow propagates box through the network with interval bounds,
+// like propagateBounds, and returns the largest magnitudes each dense and
+// conv2d layer reaches for any input in it
+func analyzeOverflow(plan []layerPlan, weights [][][]fixedpoint.Value, biases [][]fixedpoint.Value, box []interval, quant QuantConfig) []layerOverflow {
+	var res []layerOverflow
+	for layer, p := range plan {
+		if p.Param < 0 {
+			box = poolBounds(p, box)
+			continue
+		}
+		outScale := quant.ActivationScale.At(p.Param)
+		r := big.NewInt(quant.BiasScale(p.Param) / outScale)
+		activation := p.activationFn(outScale)
+		o := layerOverflow{Layer: layer, Type: p.Type}
+		next := make([]interval, p.Out.Size())
+		for i, n := range p.neurons() {
+			lo, hi := sumBounds(weights[p.Param][n.Row], biases[p.Param][n.Row], n, box)
+			for _, v := range []fixedpoint.Value{lo, hi} {
+				sum := new(big.Int).Abs(v.V)
+				if quant.Rescale == fixedpoint.HalfUp {
+					// rounded as floor((2a + r) / 2r)
+					sum.Add(sum.Lsh(sum, 1), r)
+				}
+				o.SumBits = max(o.SumBits, signedBits(sum))
+			}
+
+			lo, hi = lo.Rescale(outScale, fixedpoint.Floor), hi.Rescale(outScale, fixedpoint.Ceil)
+			o.ValueBits = max(o.ValueBits, signedBits(lo.V), signedBits(hi.V))
+			if activation.Kind.monotone() {
+				next[i] = interval{lo: activation.apply(lo, fixedpoint.Floor), hi: activation.apply(hi, fixedpoint.Ceil)}
+			} else {
+				// GELU lies between min(x, 0) and max(x, 0)
+				zero := fixedpoint.NewValue(0, outScale)
+				next[i] = interval{lo: zero, hi: zero}
+				if lo.IsNegative() {
+					next[i].lo = lo
+				}
+				if hi.Cmp(zero) > 0 {
+					next[i].hi = hi
+				}
+			}
+		}
+		res = append(res, o)
+		box = next
+	}
+	return res
+}
+
+// inputBox returns the range of every input value the prover's files allow:
+// the hull of the inputs, the ball around its center, the certified box and
+// [-InputBound, InputBound], rounded outwards to the input scale
+func (d *ProverData) inputBox(quant QuantConfig) []interval {
+	scale := int64(quant.InputScale)
+	down := func(d fixedpoint.Decimal) fixedpoint.Value {
+		v, _ := fixedpoint.Quantize(d, scale, fixedpoint.Floor)
+		return v
+	}
+	up := func(d fixedpoint.Decimal) fixedpoint.Value {
+		v, _ := fixedpoint.Quantize(d, scale, fixedpoint.Ceil)
+		return v
+	}
+	var box []interval
+	widen := func(i int, lo, hi fixedpoint.Value) {
+		if i == len(box) {
+			box = append(box, interval{lo: lo, hi: hi})
+			return
+		}
+		if lo.Cmp(box[i].lo) < 0 {
+			box[i].lo = lo
+		}
+		if hi.Cmp(box[i].hi) > 0 {
+			box[i].hi = hi
+		}
+	}
+	for _, input := range d.Inputs.Inputs {
+		for i, v := range input {
+			widen(i, down(v), up(v))
+		}
+	}
+	// every norm bounds each coordinate by the radius
+	if d.Ball != nil {
+		r := up(d.Ball.Radius)
+		for i, c := range d.Ball.Center {
+			widen(i, down(c).Sub(r), up(c).Add(r))
+		}
+	}
+	if d.Certify != nil {
+		eps := up(d.Certify.Epsilon)
+		for i, c := range d.Certify.Center {
+			widen(i, down(c).Sub(eps), up(c).Add(eps))
+		}
+	}
+	if d.InputBound != nil {
+		b := up(*d.InputBound)
+		for i := range box {
+			widen(i, fixedpoint.NewValue(0, scale).Sub(b), b)
+		}
+	}
+	return box
+}
+
+// overflow analyzes the model over the prover's inputBox on BN254
+func (d *ProverData) overflow() ([]layerOverflow, int, error) {
+	shape, err := d.Model.Shape()
+	if err != nil {
+		return nil, 0, err
+	}
+	plan, err := shape.plan()
+	if err != nil {
+		return nil, 0, err
+	}
+	// values Exact can't represent are rejected by NewAssignment, which names them
+	quant := d.Model.Quant()
+	model := *d.Model
+	if quant.Rounding == fixedpoint.Exact {
+		rounded := quant
+		rounded.Rounding = fixedpoint.HalfUp
+		model.Quantization = &rounded
+	}
+	weights, biases, err := model.Quantize()
+	if err != nil {
+		return nil, 0, err
+	}
+	return analyzeOverflow(plan, weights, biases, d.inputBox(quant), quant), ecc.BN254.ScalarField().BitLen(), nil
+}
+
+// checkOverflow returns an error if a weighted sum could wrap around the field
+// for some input in the prover's inputBox
+func (d *ProverData) checkOverflow() error {
+	layers, fieldBits, err := d.overflow()
+	if err != nil {
+		return err
+	}
+	for _, o := range layers {
+		if o.FieldHeadroom(fieldBits) < 0 {
+			return fmt.Errorf("layer %d sums can reach %d bits, past the %d the field holds, so the circuit could overflow", o.Layer, o.SumBits, fieldBits-1)
+		}
+	}
+	return nil
+}
+
+// OverflowReport prints the worst-case size of every layer's sums and how
+// much room the field and the range checks leave them
+func OverflowReport(w io.Writer, d *ProverData) error {
+	layers, fieldBits, err := d.overflow()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "field: %d bits, values range checked to %d bits\n", fieldBits, fixedpoint.FieldValueBits(fieldBits))
+	fmt.Fprintln(w, "layer  type     sum bits  field headroom  value bits  range headroom")
+	for _, o := range layers {
+		fmt.Fprintf(w, "%-6d %-8s %-9d %-15d %-11d %d\n", o.Layer, o.Type, o.SumBits, o.FieldHeadroom(fieldBits), o.ValueBits, o.RangeHeadroom(fieldBits))
+	}
+	for _, o := range layers {
+		if o.FieldHeadroom(fieldBits) < 0 {
+			fmt.Fprintf(w, "layer %d can wrap around the field, the circuit won't be compiled\n", o.Layer)
+		} else if o.RangeHeadroom(fieldBits) < 0 {
+			fmt.Fprintf(w, "layer %d can exceed the range checks, some inputs in the bounds can't be proven\n", o.Layer)
+		}
+	}
+	return nil
+}
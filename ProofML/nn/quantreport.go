@@ -0,0 +1,221 @@
+package nn
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"sudokuChecker/fixedpoint"
+)
+
+// floatForward runs the real-valued network the model was trained as and
+// returns every layer's outputs, to measure how far the circuit's fixed-point
+// pass is from it
+func floatForward(plan []layerPlan, m *ModelData, input []float64) [][]float64 {
+	trace := make([][]float64, len(plan))
+	outputs := input
+	for layer, p := range plan {
+		next := make([]float64, p.Out.Size())
+		switch p.Type {
+		case Dense, Conv2D:
+			for i, n := range p.neurons() {
+				sum := m.Biases[p.Param][n.Row].Float()
+				for j, in := range n.Inputs {
+					if in >= 0 {
+						sum += m.Weights[p.Param][n.Row][j].Float() * outputs[in]
+					}
+				}
+				next[i] = p.Layer.applyFloat(sum)
+			}
+		case MaxPool:
+			for i, window := range p.windows() {
+				next[i] = outputs[window[0]]
+				for _, in := range window[1:] {
+					next[i] = math.Max(next[i], outputs[in])
+				}
+			}
+		case AvgPool:
+			for i, window := range p.windows() {
+				for _, in := range window {
+					next[i] += outputs[in]
+				}
+				next[i] /= float64(len(window))
+			}
+		case Flatten:
+			copy(next, outputs)
+		}
+		trace[layer] = next
+		outputs = next
+	}
+	return trace
+}
+
+// applyFloat is the real-valued activation the fixed-point one approximates
+func (l Layer) applyFloat(x float64) float64 {
+	param := func(d *fixedpoint.Decimal, def float64) float64 {
+		if d == nil {
+			return def
+		}
+		return d.Float()
+	}
+	switch l.activation() {
+	case ReLU:
+		return math.Max(0, x)
+	case LeakyReLU:
+		if x < 0 {
+			return param(l.Slope, 0.01) * x
+		}
+		return x
+	case ClippedReLU:
+		return math.Min(math.Max(0, x), l.Cap.Float())
+	case HardSigmoid:
+		return math.Min(math.Max(0, param(l.Slope, 0.2)*x+0.5), 1)
+	case HardTanh:
+		c := param(l.Cap, 1)
+		return math.Min(math.Max(-c, x), c)
+	case Sigmoid:
+		return 1 / (1 + math.Exp(-x))
+	case Tanh:
+		return math.Tanh(x)
+	case GELU:
+		return x / 2 * (1 + math.Erf(x/math.Sqrt2))
+	}
+	return x
+}
+
+// quantComparison is how a quantization of the model compares with floats
+type quantComparison struct {
+	MaxError, MeanError []float64 // absolute activation error of each layer
+	Mismatches          []int     // inputs whose fixed-point class differs from the float one
+	FloatLabels         []int
+	FixedLabels         []int
+}
+
+// compareQuant runs the float and the fixed-point pass with quant on every input
+func compareQuant(m *ModelData, in *InputData, quant QuantConfig) (*quantComparison, error) {
+	shape, err := m.Shape()
+	if err != nil {
+		return nil, err
+	}
+	plan, err := shape.plan()
+	if err != nil {
+		return nil, err
+	}
+	quantized := *m
+	quantized.Quantization = &quant
+	weights, biases, err := quantized.Quantize()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &quantComparison{MaxError: make([]float64, len(plan)), MeanError: make([]float64, len(plan))}
+	counts := make([]int, len(plan))
+	for k := range in.Inputs {
+		input := make([]fixedpoint.Value, len(in.Inputs[k]))
+		floats := make([]float64, len(in.Inputs[k]))
+		for j := range in.Inputs[k] {
+			if input[j], err = fixedpoint.Quantize(in.Inputs[k][j], int64(quant.InputScale), quant.Rounding); err != nil {
+				return nil, fmt.Errorf("value %d of input %d: %w", j, k, err)
+			}
+			floats[j] = in.Inputs[k][j].Float()
+		}
+
+		fixed := traceForward(plan, weights, biases, input, quant)
+		real := floatForward(plan, m, floats)
+		for layer := range plan {
+			for i, v := range fixed[layer].Outputs {
+				e := math.Abs(v.Float() - real[layer][i])
+				c.MaxError[layer] = math.Max(c.MaxError[layer], e)
+				c.MeanError[layer] += e
+				counts[layer]++
+			}
+		}
+
+		fixedLabel := argmaxValues(fixed[len(plan)-1].Outputs)
+		floatLabel := 0
+		for i, v := range real[len(plan)-1] {
+			if v > real[len(plan)-1][floatLabel] {
+				floatLabel = i
+			}
+		}
+		c.FixedLabels, c.FloatLabels = append(c.FixedLabels, fixedLabel), append(c.FloatLabels, floatLabel)
+		if fixedLabel != floatLabel {
+			c.Mismatches = append(c.Mismatches, k)
+		}
+	}
+	for layer := range plan {
+		c.MeanError[layer] /= float64(counts[layer])
+	}
+	return c, nil
+}
+
+// smallestAgreeingScale tries ever finer scales, used for the inputs, weights
+// and activations alike, and returns the first at which every fixed-point
+// class matches the float one. Decimal models try powers of ten and binary
+// ones powers of two; values are rounded to the nearest step. The biases are
+// at the square of the scale, which has to fit in an int64, and it returns 0
+// if no scale up to there agrees.
+func smallestAgreeingScale(m *ModelData, in *InputData) (fixedpoint.Factor, error) {
+	quant := m.Quant()
+	base := fixedpoint.Factor(10)
+	if quant.InputScale.IsPowerOfTwo() {
+		base = 2
+	}
+	if quant.Rounding == fixedpoint.Exact {
+		quant.Rounding = fixedpoint.HalfUp
+	}
+	for scale := base; scale <= math.MaxInt64/scale; scale *= base {
+		quant.InputScale = scale
+		quant.WeightScale = fixedpoint.Factors{scale}
+		quant.ActivationScale = fixedpoint.Factors{scale}
+		c, err := compareQuant(m, in, quant)
+		if err != nil {
+			return 0, err
+		}
+		if len(c.Mismatches) == 0 {
+			return scale, nil
+		}
+	}
+	return 0, nil
+}
+
+// QuantReport prints how far the circuit's fixed-point pass is from the float
+// network on the given inputs, so labels the circuit won't reproduce are found
+// before proving rather than as an unsatisfied constraint
+func QuantReport(w io.Writer, m *ModelData, in *InputData) error {
+	shape, err := m.Shape()
+	if err != nil {
+		return err
+	}
+	if width := len(in.Inputs[0]); width != shape.InputSize {
+		return fmt.Errorf("inputs have %d values but the model expects %d", width, shape.InputSize)
+	}
+	plan, err := shape.plan()
+	if err != nil {
+		return err
+	}
+	c, err := compareQuant(m, in, m.Quant())
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "layer  type      max abs error  mean abs error")
+	for layer, p := range plan {
+		fmt.Fprintf(w, "%-6d %-9s %-14.6g %.6g\n", layer, p.Type, c.MaxError[layer], c.MeanError[layer])
+	}
+	fmt.Fprintf(w, "%d of %d inputs get a different class than with floats\n", len(c.Mismatches), len(in.Inputs))
+	for _, k := range c.Mismatches {
+		fmt.Fprintf(w, "  input %d: fixed point says %d, floats say %d\n", k, c.FixedLabels[k], c.FloatLabels[k])
+	}
+
+	scale, err := smallestAgreeingScale(m, in)
+	if err != nil {
+		return err
+	}
+	if scale == 0 {
+		fmt.Fprintln(w, "no scale whose square fits in an int64 agrees with floats on every input")
+	} else {
+		fmt.Fprintf(w, "smallest scale where every class agrees with floats: %s\n", scale)
+	}
+	return nil
+}
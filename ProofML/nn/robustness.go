@@ -0,0 +1,195 @@
+package nn
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+
+	"sudokuChecker/fixedpoint"
+)
+
+// Norm is the distance used for the perturbation ball around the center
+type Norm string
+
+const (
+	L2   Norm = "l2"   // Euclidean distance
+	LInf Norm = "linf" // largest coordinate difference, a box around the center
+	L1   Norm = "l1"   // sum of the coordinate differences
+)
+
+// Validate reports an error for unknown norms
+func (n Norm) Validate() error {
+	switch n {
+	case L2, LInf, L1:
+		return nil
+	}
+	return fmt.Errorf("unknown norm %q, expected %q, %q or %q", string(n), L2, LInf, L1)
+}
+
+// RobustnessBall is the public region the inputs must come from. With it the
+// proof no longer just says that some points are classified as expected, but
+// that they are points within Radius of Center.
+type RobustnessBall struct {
+	Center []frontend.Variable `gnark:",public"` // center of the ball, at the input scale
+	Radius frontend.Variable   `gnark:",public"` // radius in Norm, at the input scale
+
+	Norm Norm `gnark:"-"`
+}
+
+// SameLabel is the statement that every input and the center of the ball they
+// were sampled from get one public class. Without it the expected outputs are
+// private, so the verifier doesn't learn which class the inputs are robust for.
+type SameLabel struct {
+	Label frontend.Variable `gnark:",public"`
+}
+
+// layerTrace holds one layer's values for one input
+type layerTrace struct {
+	Sums    []fixedpoint.Value // rescaled sums before the activation, dense and conv2d layers only
+	Outputs []fixedpoint.Value
+}
+
+// traceForward runs the network on the host with the circuit's arithmetic and
+// returns every layer's values, the twin of forward.
+func traceForward(plan []layerPlan, weights [][][]fixedpoint.Value, biases [][]fixedpoint.Value, input []fixedpoint.Value, quant QuantConfig) []layerTrace {
+	trace := make([]layerTrace, len(plan))
+	outputs := input
+	for layer, p := range plan {
+		next := make([]fixedpoint.Value, p.Out.Size())
+		switch p.Type {
+		case Dense, Conv2D:
+			outScale := quant.ActivationScale.At(p.Param)
+			activation := p.activationFn(outScale)
+			sums := make([]fixedpoint.Value, len(next))
+			for i, n := range p.neurons() {
+				sum := biases[p.Param][n.Row]
+				for j, in := range n.Inputs {
+					if in >= 0 {
+						sum = sum.Add(weights[p.Param][n.Row][j].Mul(outputs[in]))
+					}
+				}
+				sums[i] = sum.Rescale(outScale, quant.Rescale)
+				next[i] = activation.apply(sums[i], quant.Rescale)
+			}
+			trace[layer].Sums = sums
+		case MaxPool:
+			for i, window := range p.windows() {
+				next[i] = outputs[window[0]]
+				for _, in := range window[1:] {
+					if outputs[in].Cmp(next[i]) > 0 {
+						next[i] = outputs[in]
+					}
+				}
+			}
+		case AvgPool:
+			for i, window := range p.windows() {
+				sum := outputs[window[0]]
+				for _, in := range window[1:] {
+					sum = sum.Add(outputs[in])
+				}
+				next[i] = fixedpoint.Value{V: sum.V, Scale: sum.Scale * int64(len(window))}.Rescale(sum.Scale, quant.Rescale)
+			}
+		case Flatten:
+			copy(next, outputs)
+		}
+		trace[layer].Outputs = next
+		outputs = next
+	}
+	return trace
+}
+
+// forwardValues returns the final layer's outputs of traceForward
+func forwardValues(plan []layerPlan, weights [][][]fixedpoint.Value, biases [][]fixedpoint.Value, input []fixedpoint.Value, quant QuantConfig) []fixedpoint.Value {
+	trace := traceForward(plan, weights, biases, input, quant)
+	return trace[len(trace)-1].Outputs
+}
+
+// predict returns the class Define's argmax picks for input
+func predict(plan []layerPlan, weights [][][]fixedpoint.Value, biases [][]fixedpoint.Value, input []fixedpoint.Value, quant QuantConfig) int {
+	return argmaxValues(forwardValues(plan, weights, biases, input, quant))
+}
+
+// argmaxValues returns the index of the largest value, the first one on ties
+func argmaxValues(values []fixedpoint.Value) int {
+	maxIdx := 0
+	for i := range values {
+		if values[i].Cmp(values[maxIdx]) > 0 {
+			maxIdx = i
+		}
+	}
+	return maxIdx
+}
+
+// ballDistance returns the distance between a and b in the given norm, the
+// host-side twin of what assertInBall computes. For L2 it is the squared
+// distance, which stays an exact integer.
+func ballDistance(norm Norm, a, b []fixedpoint.Value) fixedpoint.Value {
+	scale := a[0].Scale
+	if norm == L2 {
+		scale *= scale
+	}
+	dist := fixedpoint.NewValue(0, scale)
+	for i := range a {
+		d := a[i].Sub(b[i])
+		if d.IsNegative() {
+			d = b[i].Sub(a[i])
+		}
+		switch norm {
+		case LInf:
+			if d.Cmp(dist) > 0 {
+				dist = d
+			}
+		case L1:
+			dist = dist.Add(d)
+		default:
+			dist = dist.Add(d.Mul(d))
+		}
+	}
+	return dist
+}
+
+// ballBound returns what ballDistance is compared against, the squared radius for L2
+func ballBound(norm Norm, radius fixedpoint.Value) fixedpoint.Value {
+	if norm == L2 {
+		return radius.Mul(radius)
+	}
+	return radius
+}
+
+// radiusBound checks the public radius and returns the in-circuit twin of ballBound
+func (circuit *ProveModelCircuit) radiusBound(api frontend.API, fp *fixedpoint.API) fixedpoint.Fixed {
+	radius := fixedpoint.New(circuit.Ball.Radius, int64(circuit.Quant.InputScale))
+	fp.AssertSignedBits(radius, fixedpoint.ValueBits(api)/2)
+	api.AssertIsEqual(fp.IsNegative(radius), 0)
+	if circuit.Ball.Norm == L2 {
+		return fp.Mul(radius, radius)
+	}
+	return radius
+}
+
+// assertInBall constrains the distance between input and the ball center to
+// be at most bound. Both sides are exact integers, so no rounding is involved.
+func (circuit *ProveModelCircuit) assertInBall(api frontend.API, fp *fixedpoint.API, input []fixedpoint.Fixed, bound fixedpoint.Fixed) {
+	// bounding the differences keeps sums and squares from wrapping around the field
+	nbBits := fixedpoint.ValueBits(api) / 2
+	dist := fixedpoint.New(0, bound.Scale)
+	for i := range input {
+		d := fp.Sub(input[i], fixedpoint.New(circuit.Ball.Center[i], input[i].Scale))
+		fp.AssertSignedBits(d, nbBits)
+
+		switch circuit.Ball.Norm {
+		case LInf:
+			// every coordinate on its own: -r <= d <= r
+			api.AssertIsEqual(fp.IsLess(bound, d), 0)
+			api.AssertIsEqual(fp.IsLess(d, fp.Sub(fixedpoint.New(0, d.Scale), bound)), 0)
+		case L1:
+			abs := fp.Select(fp.IsNegative(d), fp.Sub(fixedpoint.New(0, d.Scale), d), d)
+			dist = fp.Add(dist, abs)
+		default:
+			dist = fp.Add(dist, fp.Mul(d, d))
+		}
+	}
+	if circuit.Ball.Norm != LInf {
+		api.AssertIsEqual(fp.IsLess(bound, dist), 0)
+	}
+}
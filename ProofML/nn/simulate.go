@@ -0,0 +1,78 @@
+package nn
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"sudokuChecker/fixedpoint"
+)
+
+// Simulate runs the circuit's integer forward pass on the host for every
+// input, printing each layer's values and the predicted class to w, and
+// returns the predictions. They are exactly the classes Define's argmax picks,
+// so writing them to outputs.json gives expected labels the circuit agrees
+// with. When expected is not nil every prediction is compared against it.
+func Simulate(w io.Writer, m *ModelData, in *InputData, expected *ExpectedData) ([]int, error) {
+	shape, err := m.Shape()
+	if err != nil {
+		return nil, err
+	}
+	if width := len(in.Inputs[0]); width != shape.InputSize {
+		return nil, fmt.Errorf("inputs have %d values but the model expects %d", width, shape.InputSize)
+	}
+	if expected != nil && len(expected.Expected) != len(in.Inputs) {
+		return nil, fmt.Errorf("got %d expected outputs for %d inputs", len(expected.Expected), len(in.Inputs))
+	}
+	plan, err := shape.plan()
+	if err != nil {
+		return nil, err
+	}
+	weights, biases, err := m.Quantize()
+	if err != nil {
+		return nil, err
+	}
+	quant := m.Quant()
+
+	predictions := make([]int, len(in.Inputs))
+	mismatches := 0
+	for k := range in.Inputs {
+		input := make([]fixedpoint.Value, len(in.Inputs[k]))
+		for j := range in.Inputs[k] {
+			if input[j], err = fixedpoint.Quantize(in.Inputs[k][j], int64(quant.InputScale), quant.Rounding); err != nil {
+				return nil, fmt.Errorf("value %d of input %d: %w", j, k, err)
+			}
+		}
+		trace := traceForward(plan, weights, biases, input, quant)
+		if err := checkTableDomain(plan, trace, quant); err != nil {
+			return nil, fmt.Errorf("input %d: %w", k, err)
+		}
+
+		fmt.Fprintf(w, "input %d: %s\n", k, formatValues(input))
+		for layer, p := range plan {
+			fmt.Fprintf(w, "  layer %d %s: %s\n", layer, p.Type, formatValues(trace[layer].Outputs))
+		}
+		predictions[k] = argmaxValues(trace[len(trace)-1].Outputs)
+		if expected == nil {
+			fmt.Fprintf(w, "  predicted class %d\n", predictions[k])
+		} else if predictions[k] == expected.Expected[k] {
+			fmt.Fprintf(w, "  predicted class %d, matches outputs.json\n", predictions[k])
+		} else {
+			fmt.Fprintf(w, "  predicted class %d, outputs.json says %d\n", predictions[k], expected.Expected[k])
+			mismatches++
+		}
+	}
+	if expected != nil {
+		fmt.Fprintf(w, "%d of %d inputs disagree with outputs.json\n", mismatches, len(in.Inputs))
+	}
+	return predictions, nil
+}
+
+// formatValues prints fixed-point values as exact decimals
+func formatValues(values []fixedpoint.Value) string {
+	res := make([]string, len(values))
+	for i := range values {
+		res[i] = values[i].Decimal().String()
+	}
+	return "[" + strings.Join(res, " ") + "]"
+}
@@ -0,0 +1,291 @@
+// Package onnx reads the parts of an ONNX model the ProofML importer needs:
+// the graph's nodes with their attributes, the initializers holding the
+// trained weights, and the shapes of the graph inputs. It decodes the
+// protobuf wire format directly, so it needs no generated code.
+package onnx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Graph is the computation graph of an ONNX model
+type Graph struct {
+	Nodes        []Node             // in topological order
+	Initializers map[string]*Tensor // constant inputs such as weights, by name
+	Inputs       []ValueInfo        // graph inputs, which may include the initializers
+	Outputs      []ValueInfo
+}
+
+// Node is one operator application
+type Node struct {
+	Name       string
+	OpType     string
+	Inputs     []string
+	Outputs    []string
+	Attributes map[string]Attribute
+}
+
+// Attribute is an operator attribute. Only the field matching its type is set.
+type Attribute struct {
+	Name   string
+	Float  float32
+	Int    int64
+	String []byte
+	Floats []float32
+	Ints   []int64
+}
+
+// Tensor is an initializer converted to float64, in row-major order
+type Tensor struct {
+	Name string
+	Dims []int64
+	Data []float64
+}
+
+// ValueInfo names a graph input or output and its shape. Symbolic
+// dimensions such as the batch size are -1.
+type ValueInfo struct {
+	Name string
+	Dims []int64
+}
+
+// tensor element types, from onnx.proto
+const (
+	typeFloat  = 1
+	typeDouble = 11
+)
+
+// Load reads the graph of an .onnx file
+func Load(path string) (*Graph, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	g, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return g, nil
+}
+
+// Parse decodes a serialized ModelProto and returns its graph
+func Parse(b []byte) (*Graph, error) {
+	var g *Graph
+	err := fields(b, func(num int, f field) error {
+		if num == 7 { // ModelProto.graph
+			var err error
+			g, err = parseGraph(f.bytes)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, errors.New("model has no graph")
+	}
+	return g, nil
+}
+
+func parseGraph(b []byte) (*Graph, error) {
+	g := &Graph{Initializers: map[string]*Tensor{}}
+	err := fields(b, func(num int, f field) error {
+		switch num {
+		case 1:
+			n, err := parseNode(f.bytes)
+			if err != nil {
+				return err
+			}
+			g.Nodes = append(g.Nodes, n)
+		case 5:
+			t, err := parseTensor(f.bytes)
+			if err != nil {
+				return err
+			}
+			g.Initializers[t.Name] = t
+		case 11, 12:
+			v, err := parseValueInfo(f.bytes)
+			if err != nil {
+				return err
+			}
+			if num == 11 {
+				g.Inputs = append(g.Inputs, v)
+			} else {
+				g.Outputs = append(g.Outputs, v)
+			}
+		}
+		return nil
+	})
+	return g, err
+}
+
+func parseNode(b []byte) (Node, error) {
+	n := Node{Attributes: map[string]Attribute{}}
+	err := fields(b, func(num int, f field) error {
+		switch num {
+		case 1:
+			n.Inputs = append(n.Inputs, string(f.bytes))
+		case 2:
+			n.Outputs = append(n.Outputs, string(f.bytes))
+		case 3:
+			n.Name = string(f.bytes)
+		case 4:
+			n.OpType = string(f.bytes)
+		case 5:
+			a, err := parseAttribute(f.bytes)
+			if err != nil {
+				return err
+			}
+			n.Attributes[a.Name] = a
+		}
+		return nil
+	})
+	return n, err
+}
+
+func parseAttribute(b []byte) (Attribute, error) {
+	var a Attribute
+	err := fields(b, func(num int, f field) error {
+		switch num {
+		case 1:
+			a.Name = string(f.bytes)
+		case 2:
+			a.Float = math.Float32frombits(uint32(f.value))
+		case 3:
+			a.Int = int64(f.value)
+		case 4:
+			a.String = f.bytes
+		case 7:
+			floats, err := f.float32s()
+			if err != nil {
+				return err
+			}
+			a.Floats = append(a.Floats, floats...)
+		case 8:
+			ints, err := f.int64s()
+			if err != nil {
+				return err
+			}
+			a.Ints = append(a.Ints, ints...)
+		}
+		return nil
+	})
+	return a, err
+}
+
+func parseTensor(b []byte) (*Tensor, error) {
+	t := &Tensor{}
+	dataType := int64(typeFloat)
+	var raw []byte
+	err := fields(b, func(num int, f field) error {
+		switch num {
+		case 1:
+			dims, err := f.int64s()
+			if err != nil {
+				return err
+			}
+			t.Dims = append(t.Dims, dims...)
+		case 2:
+			dataType = int64(f.value)
+		case 4:
+			floats, err := f.float32s()
+			if err != nil {
+				return err
+			}
+			for _, v := range floats {
+				t.Data = append(t.Data, float64(v))
+			}
+		case 8:
+			t.Name = string(f.bytes)
+		case 9:
+			raw = f.bytes
+		case 10:
+			doubles, err := f.float64s()
+			if err != nil {
+				return err
+			}
+			t.Data = append(t.Data, doubles...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch dataType {
+	case typeFloat:
+		if len(raw)%4 != 0 {
+			return nil, fmt.Errorf("tensor %s: raw data is not a list of floats", t.Name)
+		}
+		for i := 0; i < len(raw); i += 4 {
+			t.Data = append(t.Data, float64(math.Float32frombits(binary.LittleEndian.Uint32(raw[i:]))))
+		}
+	case typeDouble:
+		if len(raw)%8 != 0 {
+			return nil, fmt.Errorf("tensor %s: raw data is not a list of doubles", t.Name)
+		}
+		for i := 0; i < len(raw); i += 8 {
+			t.Data = append(t.Data, math.Float64frombits(binary.LittleEndian.Uint64(raw[i:])))
+		}
+	default:
+		return nil, fmt.Errorf("tensor %s has element type %d, only float and double are supported", t.Name, dataType)
+	}
+
+	size := int64(1)
+	for _, d := range t.Dims {
+		if d <= 0 {
+			return nil, fmt.Errorf("tensor %s has dims %v, they have to be positive", t.Name, t.Dims)
+		}
+		if size > math.MaxInt64/d {
+			return nil, fmt.Errorf("tensor %s has dims %v, too many values", t.Name, t.Dims)
+		}
+		size *= d
+	}
+	if int64(len(t.Data)) != size {
+		return nil, fmt.Errorf("tensor %s has %d values for dims %v", t.Name, len(t.Data), t.Dims)
+	}
+	return t, nil
+}
+
+func parseValueInfo(b []byte) (ValueInfo, error) {
+	var v ValueInfo
+	err := fields(b, func(num int, f field) error {
+		switch num {
+		case 1:
+			v.Name = string(f.bytes)
+		case 2:
+			// TypeProto.tensor_type -> TypeProto.Tensor.shape -> TensorShapeProto.dim
+			return nested(f.bytes, []int{1, 2, 1}, func(dim []byte) error {
+				d := int64(-1)
+				err := fields(dim, func(num int, f field) error {
+					if num == 1 { // dim_value, dim_param stays -1
+						d = int64(f.value)
+					}
+					return nil
+				})
+				v.Dims = append(v.Dims, d)
+				return err
+			})
+		}
+		return nil
+	})
+	return v, err
+}
+
+// nested calls fn with every message found by following path, a list of field numbers
+func nested(b []byte, path []int, fn func([]byte) error) error {
+	return fields(b, func(num int, f field) error {
+		if num != path[0] || f.bytes == nil {
+			return nil
+		}
+		if len(path) == 1 {
+			return fn(f.bytes)
+		}
+		return nested(f.bytes, path[1:], fn)
+	})
+}
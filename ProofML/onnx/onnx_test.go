@@ -0,0 +1,124 @@
+package onnx
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// message is a minimal protobuf encoder for building test models
+type message []byte
+
+func (m message) key(num, wireType int) message {
+	return binary.AppendUvarint(m, uint64(num<<3|wireType))
+}
+
+func (m message) varint(num int, v int64) message {
+	return binary.AppendUvarint(m.key(num, wireVarint), uint64(v))
+}
+
+func (m message) bytes(num int, b []byte) message {
+	m = binary.AppendUvarint(m.key(num, wireBytes), uint64(len(b)))
+	return append(m, b...)
+}
+
+func (m message) str(num int, s string) message {
+	return m.bytes(num, []byte(s))
+}
+
+func (m message) float(num int, v float32) message {
+	return binary.LittleEndian.AppendUint32(m.key(num, wireFixed32), math.Float32bits(v))
+}
+
+func packedFloats(values ...float32) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+	}
+	return b
+}
+
+func packedInts(values ...int64) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.AppendUvarint(b, uint64(v))
+	}
+	return b
+}
+
+func valueInfo(name string, dims ...int64) message {
+	var shape message
+	for _, d := range dims {
+		var dim message
+		if d < 0 {
+			dim = dim.str(2, "N")
+		} else {
+			dim = dim.varint(1, d)
+		}
+		shape = shape.bytes(1, dim)
+	}
+	tensorType := message{}.varint(1, typeFloat).bytes(2, shape)
+	return message{}.str(1, name).bytes(2, message{}.bytes(1, tensorType))
+}
+
+func TestParse(t *testing.T) {
+	// packed float_data
+	weights := message{}.bytes(1, packedInts(2, 3)).varint(2, typeFloat).str(8, "W").bytes(4, packedFloats(1, 2, 3, 4, 5, 6))
+	// unpacked dims and raw_data
+	bias := message{}.varint(1, 2).varint(2, typeFloat).str(8, "B").bytes(9, packedFloats(0.5, -0.25))
+	gemm := message{}.str(1, "x").str(1, "W").str(1, "B").str(2, "y").str(3, "fc").str(4, "Gemm").
+		bytes(5, message{}.str(1, "transB").varint(3, 1)).
+		bytes(5, message{}.str(1, "alpha").float(2, 1.5)).
+		bytes(5, message{}.str(1, "pads").bytes(8, packedInts(1, 1, 1, 1)))
+	graph := message{}.bytes(1, gemm).bytes(5, weights).bytes(5, bias).
+		bytes(11, valueInfo("x", -1, 3)).bytes(11, valueInfo("W", 2, 3)).bytes(12, valueInfo("y", -1, 2))
+	model := message{}.varint(1, 8).bytes(7, graph)
+
+	g, err := Parse(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Nodes) != 1 {
+		t.Fatalf("got %d nodes", len(g.Nodes))
+	}
+	n := g.Nodes[0]
+	if n.Name != "fc" || n.OpType != "Gemm" || !reflect.DeepEqual(n.Inputs, []string{"x", "W", "B"}) || !reflect.DeepEqual(n.Outputs, []string{"y"}) {
+		t.Errorf("wrong node %+v", n)
+	}
+	if n.Attributes["transB"].Int != 1 || n.Attributes["alpha"].Float != 1.5 || !reflect.DeepEqual(n.Attributes["pads"].Ints, []int64{1, 1, 1, 1}) {
+		t.Errorf("wrong attributes %+v", n.Attributes)
+	}
+	if w := g.Initializers["W"]; !reflect.DeepEqual(w.Dims, []int64{2, 3}) || !reflect.DeepEqual(w.Data, []float64{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("wrong weights %+v", w)
+	}
+	if b := g.Initializers["B"]; !reflect.DeepEqual(b.Dims, []int64{2}) || !reflect.DeepEqual(b.Data, []float64{0.5, -0.25}) {
+		t.Errorf("wrong biases %+v", b)
+	}
+	if !reflect.DeepEqual(g.Inputs, []ValueInfo{{"x", []int64{-1, 3}}, {"W", []int64{2, 3}}}) || !reflect.DeepEqual(g.Outputs, []ValueInfo{{"y", []int64{-1, 2}}}) {
+		t.Errorf("wrong inputs %v or outputs %v", g.Inputs, g.Outputs)
+	}
+
+	bad := message{}.varint(1, 2).varint(2, typeFloat).str(8, "B").bytes(4, packedFloats(1))
+	if _, err := Parse(message{}.bytes(7, message{}.bytes(5, bad))); err == nil {
+		t.Error("accepted a tensor with the wrong number of values")
+	}
+	// dims whose product matches the data only after wrapping around, or
+	// that are not positive
+	for _, dims := range [][]int64{{1 << 32, 1 << 32}, {-1, -1}, {0}} {
+		tensor := message{}.bytes(1, packedInts(dims...)).varint(2, typeFloat).str(8, "D")
+		if dims[0] == -1 {
+			tensor = tensor.bytes(4, packedFloats(1))
+		}
+		if _, err := Parse(message{}.bytes(7, message{}.bytes(5, tensor))); err == nil {
+			t.Errorf("accepted a tensor with dims %v", dims)
+		}
+	}
+	ints := message{}.varint(1, 1).varint(2, 7).str(8, "I").bytes(9, make([]byte, 8))
+	if _, err := Parse(message{}.bytes(7, message{}.bytes(5, ints))); err == nil {
+		t.Error("accepted an int64 tensor")
+	}
+	if _, err := Parse(model[:len(model)-3]); err == nil {
+		t.Error("accepted a truncated model")
+	}
+}
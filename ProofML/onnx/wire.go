@@ -0,0 +1,112 @@
+package onnx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// field is one decoded protobuf field. Varint and fixed size fields set
+// value, length-delimited fields set bytes.
+type field struct {
+	wireType int
+	value    uint64
+	bytes    []byte
+}
+
+// fields calls fn for every field of the message in b
+func fields(b []byte, fn func(num int, f field) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("malformed field key")
+		}
+		b = b[n:]
+		f := field{wireType: int(key & 7)}
+		switch f.wireType {
+		case wireVarint:
+			f.value, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errors.New("malformed varint")
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errors.New("truncated fixed64")
+			}
+			f.value, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errors.New("truncated fixed32")
+			}
+			f.value, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return errors.New("truncated length-delimited field")
+			}
+			f.bytes, b = b[n:n+int(length)], b[n+int(length):]
+		default:
+			return fmt.Errorf("unsupported wire type %d", f.wireType)
+		}
+		if err := fn(int(key>>3), f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// int64s returns a repeated int64 field, packed or not
+func (f field) int64s() ([]int64, error) {
+	if f.wireType != wireBytes {
+		return []int64{int64(f.value)}, nil
+	}
+	var res []int64
+	for b := f.bytes; len(b) > 0; {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("malformed packed varint")
+		}
+		res, b = append(res, int64(v)), b[n:]
+	}
+	return res, nil
+}
+
+// float32s returns a repeated float field, packed or not
+func (f field) float32s() ([]float32, error) {
+	if f.wireType != wireBytes {
+		return []float32{math.Float32frombits(uint32(f.value))}, nil
+	}
+	if len(f.bytes)%4 != 0 {
+		return nil, errors.New("malformed packed floats")
+	}
+	res := make([]float32, len(f.bytes)/4)
+	for i := range res {
+		res[i] = math.Float32frombits(binary.LittleEndian.Uint32(f.bytes[4*i:]))
+	}
+	return res, nil
+}
+
+// float64s returns a repeated double field, packed or not
+func (f field) float64s() ([]float64, error) {
+	if f.wireType != wireBytes {
+		return []float64{math.Float64frombits(f.value)}, nil
+	}
+	if len(f.bytes)%8 != 0 {
+		return nil, errors.New("malformed packed doubles")
+	}
+	res := make([]float64, len(f.bytes)/8)
+	for i := range res {
+		res[i] = math.Float64frombits(binary.LittleEndian.Uint64(f.bytes[8*i:]))
+	}
+	return res, nil
+}
@@ -0,0 +1,267 @@
+// Package proofsystem puts Groth16 and PLONK behind one interface, so every
+// circuit of the repository can be compiled, set up, proven and verified with
+// either. Groth16 needs a trusted setup per circuit. PLONK sets up every
+// circuit from one universal KZG SRS, so a model of another size needs no new
+// ceremony, at the price of larger proofs and a slower prover.
+package proofsystem
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	kzg_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/kzg"
+	"github.com/consensys/gnark-crypto/kzg"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/frontend/cs/scs"
+	"github.com/consensys/gnark/test/unsafekzg"
+)
+
+// Keys and proofs are written and read as bytes, their types depend on the
+// backend that made them
+type (
+	ProvingKey interface {
+		io.WriterTo
+		io.ReaderFrom
+	}
+	VerifyingKey interface {
+		io.WriterTo
+		io.ReaderFrom
+	}
+	Proof interface {
+		io.WriterTo
+		io.ReaderFrom
+	}
+)
+
+// Files names the files of a backend's constraint system, keys and proof
+type Files struct {
+	CS, PK, VK, Proof string
+}
+
+// Backend is a proof system on BN254
+type Backend interface {
+	// Name is groth16 or plonk, as hashed into circuit ids and recorded in bundles
+	Name() string
+	// Files are the default file names of the backend
+	Files() Files
+	// SetupID names what the keys depend on besides the circuit: nothing for
+	// Groth16 and the SRS for PLONK, so keys made from another SRS aren't reused
+	SetupID() (string, error)
+	Compile(circuit frontend.Circuit) (constraint.ConstraintSystem, error)
+	Setup(cs constraint.ConstraintSystem) (ProvingKey, VerifyingKey, error)
+	Prove(cs constraint.ConstraintSystem, pk ProvingKey, fullWitness witness.Witness) (Proof, error)
+	Verify(proof Proof, vk VerifyingKey, publicWitness witness.Witness) error
+	NewCS() constraint.ConstraintSystem
+	NewProvingKey() ProvingKey
+	NewVerifyingKey() VerifyingKey
+	NewProof() Proof
+}
+
+// New returns the backend called name, srs is the SRS file of PLONK
+func New(name, srs string) (Backend, error) {
+	switch name {
+	case "groth16":
+		if srs != "" {
+			return nil, fmt.Errorf("groth16 has a setup per circuit and takes no SRS")
+		}
+		return Groth16{}, nil
+	case "plonk":
+		return Plonk{SRS: srs}, nil
+	}
+	return nil, fmt.Errorf("unknown backend %q, expected groth16 or plonk", name)
+}
+
+// Groth16 is gnark's Groth16 on R1CS, with a setup per circuit
+type Groth16 struct{}
+
+func (Groth16) Name() string { return "groth16" }
+
+func (Groth16) Files() Files {
+	return Files{CS: "circuit.r1cs", PK: "pk.g16pk", VK: "vk.g16vk", Proof: "proof.g16p"}
+}
+
+func (Groth16) SetupID() (string, error) { return "", nil }
+
+func (Groth16) Compile(circuit frontend.Circuit) (constraint.ConstraintSystem, error) {
+	return frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, circuit)
+}
+
+func (Groth16) Setup(cs constraint.ConstraintSystem) (ProvingKey, VerifyingKey, error) {
+	return groth16.Setup(cs)
+}
+
+func (Groth16) Prove(cs constraint.ConstraintSystem, pk ProvingKey, fullWitness witness.Witness) (Proof, error) {
+	groth16PK, ok := pk.(groth16.ProvingKey)
+	if !ok {
+		return nil, fmt.Errorf("not a groth16 proving key")
+	}
+	return groth16.Prove(cs, groth16PK, fullWitness)
+}
+
+func (Groth16) Verify(proof Proof, vk VerifyingKey, publicWitness witness.Witness) error {
+	groth16Proof, ok := proof.(groth16.Proof)
+	if !ok {
+		return fmt.Errorf("not a groth16 proof")
+	}
+	groth16VK, ok := vk.(groth16.VerifyingKey)
+	if !ok {
+		return fmt.Errorf("not a groth16 verifying key")
+	}
+	return groth16.Verify(groth16Proof, groth16VK, publicWitness)
+}
+
+func (Groth16) NewCS() constraint.ConstraintSystem { return groth16.NewCS(ecc.BN254) }
+func (Groth16) NewProvingKey() ProvingKey          { return groth16.NewProvingKey(ecc.BN254) }
+func (Groth16) NewVerifyingKey() VerifyingKey      { return groth16.NewVerifyingKey(ecc.BN254) }
+func (Groth16) NewProof() Proof                    { return groth16.NewProof(ecc.BN254) }
+
+// UnsafeSetup is the SetupID of PLONK keys set up from an SRS generated with
+// unsafekzg. Its secret is known to the machine that made it, which can prove
+// anything, so proofs made with such keys only do for tests.
+const UnsafeSetup = "unsafe"
+
+// UnsafeSetupWarning is printed by the commands that set up or prove with an
+// UnsafeSetup
+const UnsafeSetupWarning = "WARNING: no SRS given, generating an unsafe one for testing. Its secret is known to this machine, so the proofs made with it prove nothing, and verifiers refuse them unless told to accept unsafe setups."
+
+// CheckSetup returns an error for a proof recorded as made with an
+// UnsafeSetup, unless the verifier allows it for testing. The record is the
+// prover's word: it keeps honest test proofs from passing for real ones, the
+// verifier's own key is what rules out a dishonest setup.
+func CheckSetup(setupID string, allowUnsafe bool) error {
+	if setupID == UnsafeSetup && !allowUnsafe {
+		return fmt.Errorf("the proof was made with keys set up from an unsafe SRS generated for testing")
+	}
+	return nil
+}
+
+// Plonk is gnark's PLONK on sparse R1CS with KZG commitments
+type Plonk struct {
+	// SRS is a universal BN254 KZG SRS in gnark-crypto's binary format, such
+	// as the powers of tau of a public ceremony, with at least as many powers
+	// as the circuit needs. Empty generates one with unsafekzg, whose secret
+	// is known to this machine: only for tests.
+	SRS string
+}
+
+func (Plonk) Name() string { return "plonk" }
+
+func (Plonk) Files() Files {
+	return Files{CS: "circuit.scs", PK: "pk.plonkpk", VK: "vk.plonkvk", Proof: "proof.plonkp"}
+}
+
+// SetupID is a hash of the SRS file, or UnsafeSetup for the generated one
+func (p Plonk) SetupID() (string, error) {
+	if p.SRS == "" {
+		return UnsafeSetup, nil
+	}
+	f, err := os.Open(p.SRS)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("%s: %w", p.SRS, err)
+	}
+	return "srs-" + hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
+
+func (Plonk) Compile(circuit frontend.Circuit) (constraint.ConstraintSystem, error) {
+	return frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, circuit)
+}
+
+func (p Plonk) Setup(cs constraint.ConstraintSystem) (ProvingKey, VerifyingKey, error) {
+	canonical, lagrange, err := p.srs(cs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plonk.Setup(cs, canonical, lagrange)
+}
+
+// srs returns the SRS of cs in canonical and in Lagrange form
+func (p Plonk) srs(cs constraint.ConstraintSystem) (kzg.SRS, kzg.SRS, error) {
+	if p.SRS == "" {
+		return unsafekzg.NewSRS(cs)
+	}
+	var srs kzg_bn254.SRS
+	f, err := os.Open(p.SRS)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	if _, err := srs.ReadFrom(f); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", p.SRS, err)
+	}
+	sizeCanonical, sizeLagrange := plonk.SRSSize(cs)
+	if len(srs.Pk.G1) < sizeCanonical {
+		return nil, nil, fmt.Errorf("%s holds %d powers, the circuit needs %d", p.SRS, len(srs.Pk.G1), sizeCanonical)
+	}
+	lagrangeG1, err := kzg_bn254.ToLagrangeG1(srs.Pk.G1[:sizeLagrange])
+	if err != nil {
+		return nil, nil, err
+	}
+	canonical := &kzg_bn254.SRS{Pk: kzg_bn254.ProvingKey{G1: srs.Pk.G1[:sizeCanonical]}, Vk: srs.Vk}
+	lagrange := &kzg_bn254.SRS{Pk: kzg_bn254.ProvingKey{G1: lagrangeG1}, Vk: srs.Vk}
+	return canonical, lagrange, nil
+}
+
+func (Plonk) Prove(cs constraint.ConstraintSystem, pk ProvingKey, fullWitness witness.Witness) (Proof, error) {
+	plonkPK, ok := pk.(plonk.ProvingKey)
+	if !ok {
+		return nil, fmt.Errorf("not a plonk proving key")
+	}
+	return plonk.Prove(cs, plonkPK, fullWitness)
+}
+
+func (Plonk) Verify(proof Proof, vk VerifyingKey, publicWitness witness.Witness) error {
+	plonkProof, ok := proof.(plonk.Proof)
+	if !ok {
+		return fmt.Errorf("not a plonk proof")
+	}
+	plonkVK, ok := vk.(plonk.VerifyingKey)
+	if !ok {
+		return fmt.Errorf("not a plonk verifying key")
+	}
+	return plonk.Verify(plonkProof, plonkVK, publicWitness)
+}
+
+func (Plonk) NewCS() constraint.ConstraintSystem { return plonk.NewCS(ecc.BN254) }
+func (Plonk) NewProvingKey() ProvingKey          { return plonk.NewProvingKey(ecc.BN254) }
+func (Plonk) NewVerifyingKey() VerifyingKey      { return plonk.NewVerifyingKey(ecc.BN254) }
+func (Plonk) NewProof() Proof                    { return plonk.NewProof(ecc.BN254) }
+
+// ReadFrom fills v, a key, proof or constraint system, from the file at path
+func ReadFrom(path string, v io.ReaderFrom) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := v.ReadFrom(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// WriteTo writes v, a key, proof or constraint system, to the file at path
+func WriteTo(path string, v io.WriterTo) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := v.WriteTo(f); err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return f.Close()
+}
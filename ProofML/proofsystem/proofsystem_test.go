@@ -0,0 +1,100 @@
+package proofsystem
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	kzg_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/kzg"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+	"github.com/consensys/gnark/test/unsafekzg"
+)
+
+// cubeCircuit proves knowledge of X with X^3 + X + 5 = Y
+type cubeCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *cubeCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(c.Y, api.Add(api.Mul(c.X, c.X, c.X), c.X, 5))
+	return nil
+}
+
+func TestBackends(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	// an SRS file in the format a ceremony would publish
+	dir := t.TempDir()
+	srsFile := filepath.Join(dir, "srs.bin")
+	ccs, err := Plonk{}.Compile(&cubeCircuit{})
+	assert.NoError(err)
+	canonical, _, err := unsafekzg.NewSRS(ccs)
+	assert.NoError(err)
+	f, err := os.Create(srsFile)
+	assert.NoError(err)
+	_, err = canonical.WriteTo(f)
+	assert.NoError(err)
+	assert.NoError(f.Close())
+
+	for _, backend := range []Backend{Groth16{}, Plonk{}, Plonk{SRS: srsFile}} {
+		cs, err := backend.Compile(&cubeCircuit{})
+		assert.NoError(err)
+		pk, vk, err := backend.Setup(cs)
+		assert.NoError(err, backend.Name())
+
+		witness, err := frontend.NewWitness(&cubeCircuit{X: 3, Y: 35}, ecc.BN254.ScalarField())
+		assert.NoError(err)
+		proof, err := backend.Prove(cs, pk, witness)
+		assert.NoError(err)
+		public, err := witness.Public()
+		assert.NoError(err)
+		assert.NoError(backend.Verify(proof, vk, public), backend.Name())
+
+		wrong, err := frontend.NewWitness(&cubeCircuit{Y: 36}, ecc.BN254.ScalarField(), frontend.PublicOnly())
+		assert.NoError(err)
+		assert.Error(backend.Verify(proof, vk, wrong))
+	}
+
+	// keys of one backend are refused by the other
+	cs, err := Groth16{}.Compile(&cubeCircuit{})
+	assert.NoError(err)
+	pk, _, err := Groth16{}.Setup(cs)
+	assert.NoError(err)
+	witness, err := frontend.NewWitness(&cubeCircuit{X: 3, Y: 35}, ecc.BN254.ScalarField())
+	assert.NoError(err)
+	_, err = Plonk{}.Prove(cs, pk, witness)
+	assert.Error(err)
+
+	// the SRS has to be large enough for the circuit
+	small := *canonical.(*kzg_bn254.SRS)
+	small.Pk.G1 = small.Pk.G1[:2]
+	f, err = os.Create(filepath.Join(dir, "small.bin"))
+	assert.NoError(err)
+	_, err = small.WriteTo(f)
+	assert.NoError(err)
+	assert.NoError(f.Close())
+	cs, err = Plonk{}.Compile(&cubeCircuit{})
+	assert.NoError(err)
+	_, _, err = Plonk{SRS: filepath.Join(dir, "small.bin")}.Setup(cs)
+	assert.ErrorContains(err, "holds 2 powers")
+
+	// keys are only reused with the same SRS
+	unsafeID, err := Plonk{}.SetupID()
+	assert.NoError(err)
+	fileID, err := Plonk{SRS: srsFile}.SetupID()
+	assert.NoError(err)
+	assert.NotEqual(unsafeID, fileID)
+
+	// and proofs from the generated one are refused unless allowed
+	assert.ErrorContains(CheckSetup(unsafeID, false), "unsafe SRS")
+	assert.NoError(CheckSetup(unsafeID, true))
+	assert.NoError(CheckSetup(fileID, false))
+
+	_, err = New("groth16", srsFile)
+	assert.Error(err)
+	_, err = New("stark", "")
+	assert.Error(err)
+}
@@ -0,0 +1,146 @@
+// Package sudoku is the Sudoku circuit of Sudoku/Prover and ReadAndWrite,
+// which proves knowledge of the solution of a public puzzle, for the zk
+// command to prove alongside the neural network.
+package sudoku
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+)
+
+// CircuitID names the Sudoku circuit in proof bundles. It has a single shape,
+// so the id only changes when Define does.
+const CircuitID = "sudoku-9x9-v1"
+
+// SudokuCircuit proves that CompleteGrid is a solution of the public IncompleteGrid
+type SudokuCircuit struct {
+	IncompleteGrid [9][9]frontend.Variable `gnark:"IncompleteSudoku,public"`
+	CompleteGrid   [9][9]frontend.Variable `gnark:"CompleteSudoku"`
+}
+
+// Sudoku is the format of public.json and private.json, with 0 for an empty cell
+type Sudoku struct {
+	Grid [9][9]int `json:"grid"`
+}
+
+func (circuit *SudokuCircuit) Define(api frontend.API) error {
+	// Constraint 1: Each cell value in the CompleteGrid must be between 1 and 9
+	for i := 0; i < 9; i++ {
+		for j := 0; j < 9; j++ {
+			api.AssertIsLessOrEqual(circuit.CompleteGrid[i][j], 9)
+			api.AssertIsLessOrEqual(1, circuit.CompleteGrid[i][j])
+		}
+	}
+
+	// Constraint 2: Each row in the CompleteGrid must contain unique values
+	for i := 0; i < 9; i++ {
+		for j := 0; j < 9; j++ {
+			for k := j + 1; k < 9; k++ {
+				api.AssertIsDifferent(circuit.CompleteGrid[i][j], circuit.CompleteGrid[i][k])
+			}
+		}
+	}
+
+	// Constraint 3: Each column in the CompleteGrid must contain unique values
+	for j := 0; j < 9; j++ {
+		for i := 0; i < 9; i++ {
+			for k := i + 1; k < 9; k++ {
+				api.AssertIsDifferent(circuit.CompleteGrid[i][j], circuit.CompleteGrid[k][j])
+			}
+		}
+	}
+
+	// Constraint 4: Each 3x3 sub-grid in the CompleteGrid must contain unique values
+	for boxRow := 0; boxRow < 3; boxRow++ {
+		for boxCol := 0; boxCol < 3; boxCol++ {
+			for i := 0; i < 9; i++ {
+				for j := i + 1; j < 9; j++ {
+					row1 := boxRow*3 + i/3
+					col1 := boxCol*3 + i%3
+					row2 := boxRow*3 + j/3
+					col2 := boxCol*3 + j%3
+					api.AssertIsDifferent(circuit.CompleteGrid[row1][col1], circuit.CompleteGrid[row2][col2])
+				}
+			}
+		}
+	}
+
+	// Constraint 5: The values in the IncompleteGrid must match the CompleteGrid where provided
+	for i := 0; i < 9; i++ {
+		for j := 0; j < 9; j++ {
+			isCellGiven := api.IsZero(circuit.IncompleteGrid[i][j])
+			api.AssertIsEqual(api.Select(isCellGiven, circuit.CompleteGrid[i][j], circuit.IncompleteGrid[i][j]), circuit.CompleteGrid[i][j])
+		}
+	}
+
+	return nil
+}
+
+// Load reads a grid and checks that every cell is empty or holds 1 to 9
+func Load(path string) (*Sudoku, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Sudoku
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	for i := range s.Grid {
+		for j, v := range s.Grid[i] {
+			if v < 0 || v > 9 {
+				return nil, fmt.Errorf("%s: cell %d,%d holds %d", path, i, j, v)
+			}
+		}
+	}
+	return &s, nil
+}
+
+// NewAssignment fills the circuit with the puzzle and its solution. It fails
+// if the solution changes a given cell, which would leave Define unsatisfied.
+func NewAssignment(puzzle, solution *Sudoku) (*SudokuCircuit, error) {
+	assignment := PublicAssignment(puzzle)
+	for i := 0; i < 9; i++ {
+		for j := 0; j < 9; j++ {
+			if given := puzzle.Grid[i][j]; given != 0 && given != solution.Grid[i][j] {
+				return nil, fmt.Errorf("the solution has %d at %d,%d where the puzzle gives %d", solution.Grid[i][j], i, j, given)
+			}
+			assignment.CompleteGrid[i][j] = frontend.Variable(solution.Grid[i][j])
+		}
+	}
+	return assignment, nil
+}
+
+// PublicAssignment fills the public puzzle only, for verifying
+func PublicAssignment(puzzle *Sudoku) *SudokuCircuit {
+	assignment := &SudokuCircuit{}
+	for i := 0; i < 9; i++ {
+		for j := 0; j < 9; j++ {
+			assignment.IncompleteGrid[i][j] = frontend.Variable(puzzle.Grid[i][j])
+		}
+	}
+	return assignment
+}
+
+// Puzzle reads the puzzle out of the public witness of a proof. It fails
+// unless the witness is 81 cells of 0 to 9, so the witness of a model
+// circuit, which starts with its circuit tag, isn't taken for a puzzle.
+func Puzzle(publicWitness witness.Witness) (*Sudoku, error) {
+	vector, ok := publicWitness.Vector().(fr.Vector)
+	if !ok || len(vector) != 81 {
+		return nil, fmt.Errorf("the public witness isn't a Sudoku puzzle")
+	}
+	var puzzle Sudoku
+	for k := range vector {
+		if !vector[k].IsUint64() || vector[k].Uint64() > 9 {
+			return nil, fmt.Errorf("cell %d,%d of the puzzle is %s, not 0 to 9", k/9, k%9, vector[k].String())
+		}
+		puzzle.Grid[k/9][k%9] = int(vector[k].Uint64())
+	}
+	return &puzzle, nil
+}
@@ -0,0 +1,62 @@
+package sudoku
+
+import (
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/test"
+)
+
+var (
+	testPuzzle = Sudoku{Grid: [9][9]int{
+		{5, 3, 0, 0, 7, 0, 0, 0, 0},
+		{6, 0, 0, 1, 9, 5, 0, 0, 0},
+		{0, 9, 8, 0, 0, 0, 0, 6, 0},
+		{8, 0, 0, 0, 6, 0, 0, 0, 3},
+		{4, 0, 0, 8, 0, 3, 0, 0, 1},
+		{7, 0, 0, 0, 2, 0, 0, 0, 6},
+		{0, 6, 0, 0, 0, 0, 2, 8, 0},
+		{0, 0, 0, 4, 1, 9, 0, 0, 5},
+		{0, 0, 0, 0, 8, 0, 0, 7, 9},
+	}}
+	testSolution = Sudoku{Grid: [9][9]int{
+		{5, 3, 4, 6, 7, 8, 9, 1, 2},
+		{6, 7, 2, 1, 9, 5, 3, 4, 8},
+		{1, 9, 8, 3, 4, 2, 5, 6, 7},
+		{8, 5, 9, 7, 6, 1, 4, 2, 3},
+		{4, 2, 6, 8, 5, 3, 7, 9, 1},
+		{7, 1, 3, 9, 2, 4, 8, 5, 6},
+		{9, 6, 1, 5, 3, 7, 2, 8, 4},
+		{2, 8, 7, 4, 1, 9, 6, 3, 5},
+		{3, 4, 5, 2, 8, 6, 1, 7, 9},
+	}}
+)
+
+func TestSudoku(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	field := ecc.BN254.ScalarField()
+	ccs, err := frontend.Compile(field, r1cs.NewBuilder, &SudokuCircuit{})
+	assert.NoError(err)
+	assignment, err := NewAssignment(&testPuzzle, &testSolution)
+	assert.NoError(err)
+	witness, err := frontend.NewWitness(assignment, field)
+	assert.NoError(err)
+	assert.NoError(ccs.IsSolved(witness))
+
+	// swapping two cells of a row keeps the givens but repeats digits in the columns
+	wrong := testSolution
+	wrong.Grid[0][2], wrong.Grid[0][3] = wrong.Grid[0][3], wrong.Grid[0][2]
+	assignment, err = NewAssignment(&testPuzzle, &wrong)
+	assert.NoError(err)
+	witness, err = frontend.NewWitness(assignment, field)
+	assert.NoError(err)
+	assert.Error(ccs.IsSolved(witness))
+
+	// changing a given is caught before proving
+	wrong.Grid[0][0] = 1
+	_, err = NewAssignment(&testPuzzle, &wrong)
+	assert.ErrorContains(err, "where the puzzle gives 5")
+}
@@ -0,0 +1,681 @@
+// Command zk compiles, sets up, proves, verifies and inspects the circuits of
+// this repository, reading and writing the files named by its flags:
+//
+//	zk compile --circuit nn --weights weights.json --inputs inputs.json --outputs outputs.json --cs circuit.r1cs
+//	zk setup --cs circuit.r1cs --pk pk.g16pk --vk vk.g16vk
+//	zk prove --circuit nn --weights weights.json --inputs inputs.json --outputs outputs.json --cs circuit.r1cs --pk pk.g16pk --proof proof.g16p --meta proof.meta.json
+//	zk verify --circuit nn --vk vk.g16vk --proof proof.g16p --meta proof.meta.json --inputs inputs.json
+//	zk verify --vk vk.g16vk --bundle proof.bundle.json
+//	zk inspect --cs circuit.r1cs --vk vk.g16vk --proof proof.g16p --meta proof.meta.json --bundle proof.bundle.json
+//
+// --circuit nn is the neural-network prover of main.go, with the same -ball,
+// -certify, -same-label, -margin and -report-margin statements. --circuit
+// lipschitz proves that the model's Lipschitz bound is at most --bound, with
+// its metadata in lipschitz.meta.json. --circuit sudoku proves a solution of
+// the puzzle in --public, read from --private.
+// --backend plonk proves with PLONK instead of Groth16, set up from the
+// universal SRS in --srs, or from an unsafe one generated for testing when
+// --srs is empty, with a warning. The file flags then default to circuit.scs,
+// pk.plonkpk, vk.plonkvk and proof.plonkp. prove records the setup of --srs in
+// the metadata and the bundle, and verify refuses proofs recorded as made with
+// an unsafe one unless --allow-unsafe-srs is given.
+//
+// prove also writes a proof bundle, --bundle proof.bundle.json, which verify
+// checks on its own when --bundle is given, against the verifier's --vk or a
+// key with the pinned --fingerprint. Every subcommand
+// exits with status 1 when it fails, so a failed verification can be tested
+// for in scripts.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"sudokuChecker/bundle"
+	"sudokuChecker/fixedpoint"
+	"sudokuChecker/nn"
+	"sudokuChecker/proofsystem"
+	"sudokuChecker/sudoku"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+)
+
+// options holds the flags of every subcommand, each uses the ones it needs
+type options struct {
+	circuit                 string
+	cs, pk, vk, proof, meta string
+	bundle, fingerprint     string
+	weights, onnx           string
+	inputs, outputs         string
+	ball, certify, margin   string
+	inputBound, bound       string
+	sameLabel, reportMargin bool
+	allowUnsafeSRS          bool
+	public, private         string
+	set                     map[string]bool // flags given on the command line
+	backend                 proofsystem.Backend
+}
+
+func parseOptions(cmd string, args []string) (*options, error) {
+	o := &options{set: map[string]bool{}}
+	fs := flag.NewFlagSet("zk "+cmd, flag.ContinueOnError)
+	fs.StringVar(&o.circuit, "circuit", "nn", "circuit to use, nn, lipschitz or sudoku")
+	backendName := fs.String("backend", "groth16", "proof system, groth16 or plonk")
+	srs := fs.String("srs", "", "universal KZG SRS the plonk setup reads, empty to generate an unsafe one for testing")
+	fs.BoolVar(&o.allowUnsafeSRS, "allow-unsafe-srs", false, "verify proofs whose keys were set up from an unsafe SRS generated for testing")
+	fs.StringVar(&o.cs, "cs", "", "compiled constraint system, circuit.r1cs or circuit.scs by default")
+	fs.StringVar(&o.pk, "pk", "", "proving key, pk.g16pk or pk.plonkpk by default")
+	fs.StringVar(&o.vk, "vk", "", "verifying key, vk.g16vk or vk.plonkvk by default")
+	fs.StringVar(&o.proof, "proof", "", "proof, proof.g16p or proof.plonkp by default")
+	fs.StringVar(&o.bundle, "bundle", "proof.bundle.json", "self-describing proof, written by prove; verify and inspect read it when given")
+	fs.StringVar(&o.fingerprint, "fingerprint", "", "fingerprint the verifying key of a --bundle has to have, when --vk isn't a key you trust")
+	fs.StringVar(&o.meta, "meta", "", "metadata of a neural-network proof, written by prove and read by verify, proof.meta.json or lipschitz.meta.json by default")
+	fs.StringVar(&o.weights, "weights", "weights.json", "model of the neural network")
+	fs.StringVar(&o.onnx, "onnx", "", "model.onnx to import instead of reading --weights")
+	fs.StringVar(&o.inputs, "inputs", "inputs.json", "public inputs of the neural network")
+	fs.StringVar(&o.outputs, "outputs", "outputs.json", "expected classes of the inputs")
+	fs.StringVar(&o.ball, "ball", "", "initialPoint.json to check every input against, empty to skip")
+	fs.StringVar(&o.certify, "certify", "", "box to certify, in the initialPoint.json format plus a \"label\", empty to skip")
+	fs.BoolVar(&o.sameLabel, "same-label", false, "prove that every input and the ball center get one public label")
+	fs.StringVar(&o.margin, "margin", "", "margin every input has to win by, empty for none")
+	fs.BoolVar(&o.reportMargin, "report-margin", false, "publish the smallest margin the inputs win by")
+	fs.StringVar(&o.bound, "bound", "", "Lipschitz bound the lipschitz circuit proves, such as 3.5")
+	fs.StringVar(&o.inputBound, "input-bound", "", "largest absolute input value the overflow analysis has to cover, empty to only cover the files")
+	fs.StringVar(&o.public, "public", "public.json", "Sudoku puzzle, 0 for an empty cell")
+	fs.StringVar(&o.private, "private", "private.json", "solution of the Sudoku puzzle")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	fs.Visit(func(f *flag.Flag) { o.set[f.Name] = true })
+	var err error
+	if o.backend, err = proofsystem.New(*backendName, *srs); err != nil {
+		return nil, err
+	}
+	files, meta := o.backend.Files(), "proof.meta.json"
+	if o.circuit == "lipschitz" {
+		meta = nn.LipschitzMetaFile
+	}
+	for _, f := range []struct {
+		dst  *string
+		name string
+	}{{&o.cs, files.CS}, {&o.pk, files.PK}, {&o.vk, files.VK}, {&o.proof, files.Proof}, {&o.meta, meta}} {
+		if *f.dst == "" {
+			*f.dst = f.name
+		}
+	}
+	return o, nil
+}
+
+// circuit is what the subcommands need from one kind of circuit
+type circuit interface {
+	// Definition returns the circuit to compile
+	Definition() (frontend.Circuit, error)
+	// Assignment returns the full assignment to prove
+	Assignment() (frontend.Circuit, error)
+	// Public returns the public part of the assignment a proof is checked against
+	Public() (frontend.Circuit, error)
+	// Proven writes what a verifier needs besides the proof
+	Proven(assignment frontend.Circuit) error
+	// Describe returns what a proof bundle records about the circuit
+	Describe() (bundle.Circuit, error)
+}
+
+func newCircuit(o *options) (circuit, error) {
+	switch o.circuit {
+	case "nn":
+		return &nnCircuit{o: o}, nil
+	case "lipschitz":
+		return &lipschitzCircuit{o: o}, nil
+	case "sudoku":
+		return sudokuCircuit{o: o}, nil
+	}
+	return nil, fmt.Errorf("unknown circuit %q, expected nn, lipschitz or sudoku", o.circuit)
+}
+
+// loadModel reads --onnx, or --weights when it isn't given
+func loadModel(o *options) (*nn.ModelData, error) {
+	if o.onnx != "" {
+		return nn.LoadONNX(o.onnx, nn.DefaultONNXQuant())
+	}
+	return nn.LoadModel(o.weights)
+}
+
+// nnCircuit is the neural-network circuit of main.go
+type nnCircuit struct {
+	o     *options
+	data  *nn.ProverData
+	shape nn.ModelShape
+}
+
+// load reads the prover's files once
+func (c *nnCircuit) load() error {
+	if c.data != nil {
+		return nil
+	}
+	o := c.o
+	var (
+		d   nn.ProverData
+		err error
+	)
+	if d.Model, err = loadModel(o); err != nil {
+		return err
+	}
+	if d.Inputs, err = nn.LoadInputs(o.inputs); err != nil {
+		return err
+	}
+	if d.Expected, err = nn.LoadExpected(o.outputs); err != nil {
+		return err
+	}
+	if o.ball != "" {
+		if d.Ball, err = nn.LoadBall(o.ball); err != nil {
+			return err
+		}
+	}
+	if o.certify != "" {
+		if d.Certify, err = nn.LoadCertify(o.certify); err != nil {
+			return err
+		}
+	}
+	for _, f := range []struct {
+		flag string
+		dst  **fixedpoint.Decimal
+	}{{o.margin, &d.Margin}, {o.inputBound, &d.InputBound}} {
+		if f.flag == "" {
+			continue
+		}
+		v, err := fixedpoint.ParseDecimal(f.flag)
+		if err != nil {
+			return err
+		}
+		*f.dst = &v
+	}
+	d.SameLabel, d.ReportMargin = o.sameLabel, o.reportMargin
+	if c.shape, err = nn.CircuitShape(&d); err != nil {
+		return err
+	}
+	c.data = &d
+	return nil
+}
+
+func (c *nnCircuit) Definition() (frontend.Circuit, error) {
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return nn.NewProveModelCircuit(c.shape, c.data.Model.Quant()), nil
+}
+
+func (c *nnCircuit) Assignment() (frontend.Circuit, error) {
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return nn.NewAssignment(c.shape, c.data)
+}
+
+func (c *nnCircuit) Public() (frontend.Circuit, error) {
+	meta, err := nn.LoadMetadata(c.o.meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := proofsystem.CheckSetup(meta.Setup, c.o.allowUnsafeSRS); err != nil {
+		return nil, err
+	}
+	inputs, err := nn.LoadInputs(c.o.inputs)
+	if err != nil {
+		return nil, err
+	}
+	return nn.PublicAssignment(meta, inputs)
+}
+
+func (c *nnCircuit) Proven(assignment frontend.Circuit) error {
+	meta := nn.NewProofMetadata(c.shape, c.data, assignment.(*nn.ProveModelCircuit))
+	var err error
+	if meta.Setup, err = c.o.backend.SetupID(); err != nil {
+		return err
+	}
+	return nn.WriteJSON(c.o.meta, meta)
+}
+
+func (c *nnCircuit) Describe() (bundle.Circuit, error) {
+	if err := c.load(); err != nil {
+		return bundle.Circuit{}, err
+	}
+	return bundle.Model("model", c.o.backend, c.shape, c.data.Model.Quant()), nil
+}
+
+// lipschitzCircuit bounds the Lipschitz constant of the model of main.go
+type lipschitzCircuit struct {
+	o     *options
+	model *nn.ModelData
+	shape nn.ModelShape
+}
+
+// load reads the model once
+func (c *lipschitzCircuit) load() error {
+	if c.model != nil {
+		return nil
+	}
+	m, err := loadModel(c.o)
+	if err != nil {
+		return err
+	}
+	if c.shape, err = m.Shape(); err != nil {
+		return err
+	}
+	c.model = m
+	return nil
+}
+
+func (c *lipschitzCircuit) Definition() (frontend.Circuit, error) {
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return nn.NewLipschitzCircuit(c.shape, c.model.Quant()), nil
+}
+
+func (c *lipschitzCircuit) Assignment() (frontend.Circuit, error) {
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	if c.o.bound == "" {
+		return nil, errors.New("the lipschitz circuit needs a --bound")
+	}
+	bound, err := fixedpoint.ParseDecimal(c.o.bound)
+	if err != nil {
+		return nil, err
+	}
+	return nn.NewLipschitzAssignment(c.model, bound)
+}
+
+func (c *lipschitzCircuit) Public() (frontend.Circuit, error) {
+	meta, err := nn.LoadLipschitzMetadata(c.o.meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := proofsystem.CheckSetup(meta.Setup, c.o.allowUnsafeSRS); err != nil {
+		return nil, err
+	}
+	return nn.LipschitzPublicAssignment(meta)
+}
+
+func (c *lipschitzCircuit) Proven(assignment frontend.Circuit) error {
+	meta := nn.NewLipschitzMetadata(c.shape, c.model.Quant(), assignment.(*nn.LipschitzCircuit))
+	var err error
+	if meta.Setup, err = c.o.backend.SetupID(); err != nil {
+		return err
+	}
+	return nn.WriteJSON(c.o.meta, meta)
+}
+
+func (c *lipschitzCircuit) Describe() (bundle.Circuit, error) {
+	if err := c.load(); err != nil {
+		return bundle.Circuit{}, err
+	}
+	return bundle.Model("lipschitz", c.o.backend, c.shape, c.model.Quant()), nil
+}
+
+// sudokuCircuit is the Sudoku circuit of Sudoku/Prover and ReadAndWrite
+type sudokuCircuit struct {
+	o *options
+}
+
+func (c sudokuCircuit) Definition() (frontend.Circuit, error) {
+	return &sudoku.SudokuCircuit{}, nil
+}
+
+func (c sudokuCircuit) Assignment() (frontend.Circuit, error) {
+	puzzle, err := sudoku.Load(c.o.public)
+	if err != nil {
+		return nil, err
+	}
+	solution, err := sudoku.Load(c.o.private)
+	if err != nil {
+		return nil, err
+	}
+	return sudoku.NewAssignment(puzzle, solution)
+}
+
+func (c sudokuCircuit) Public() (frontend.Circuit, error) {
+	puzzle, err := sudoku.Load(c.o.public)
+	if err != nil {
+		return nil, err
+	}
+	return sudoku.PublicAssignment(puzzle), nil
+}
+
+// Proven has nothing to write, the puzzle is already in --public
+func (c sudokuCircuit) Proven(frontend.Circuit) error {
+	return nil
+}
+
+func (c sudokuCircuit) Describe() (bundle.Circuit, error) {
+	return bundle.Sudoku(c.o.backend), nil
+}
+
+// compile writes the constraint system of the circuit to --cs
+func compile(w io.Writer, o *options) error {
+	c, err := newCircuit(o)
+	if err != nil {
+		return err
+	}
+	definition, err := c.Definition()
+	if err != nil {
+		return err
+	}
+	cs, err := o.backend.Compile(definition)
+	if err != nil {
+		return fmt.Errorf("compiling circuit: %w", err)
+	}
+	if err := proofsystem.WriteTo(o.cs, cs); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s: ", o.cs)
+	describeCS(w, cs)
+	return nil
+}
+
+// warnUnsafe warns on stderr when --backend and --srs set up from an unsafe
+// SRS
+func warnUnsafe(o *options) error {
+	setupID, err := o.backend.SetupID()
+	if err != nil {
+		return err
+	}
+	if setupID == proofsystem.UnsafeSetup {
+		fmt.Fprintln(os.Stderr, proofsystem.UnsafeSetupWarning)
+	}
+	return nil
+}
+
+// setup runs the setup of --cs and writes --pk and --vk
+func setup(w io.Writer, o *options) error {
+	if err := warnUnsafe(o); err != nil {
+		return err
+	}
+	cs := o.backend.NewCS()
+	if err := proofsystem.ReadFrom(o.cs, cs); err != nil {
+		return err
+	}
+	pk, vk, err := o.backend.Setup(cs)
+	if err != nil {
+		return fmt.Errorf("setup: %w", err)
+	}
+	if err := proofsystem.WriteTo(o.pk, pk); err != nil {
+		return err
+	}
+	if err := proofsystem.WriteTo(o.vk, vk); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "wrote %s and %s\n", o.pk, o.vk)
+	return nil
+}
+
+// prove proves the circuit's files with --cs and --pk and writes --proof,
+// and a bundle of it for --vk to --bundle
+func prove(w io.Writer, o *options) error {
+	if err := warnUnsafe(o); err != nil {
+		return err
+	}
+	c, err := newCircuit(o)
+	if err != nil {
+		return err
+	}
+	assignment, err := c.Assignment()
+	if err != nil {
+		return err
+	}
+	cs := o.backend.NewCS()
+	if err := proofsystem.ReadFrom(o.cs, cs); err != nil {
+		return err
+	}
+	pk := o.backend.NewProvingKey()
+	if err := proofsystem.ReadFrom(o.pk, pk); err != nil {
+		return err
+	}
+	witness, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
+	if err != nil {
+		return fmt.Errorf("creating witness: %w", err)
+	}
+	proof, err := o.backend.Prove(cs, pk, witness)
+	if err != nil {
+		return fmt.Errorf("proving: %w", err)
+	}
+	if err := proofsystem.WriteTo(o.proof, proof); err != nil {
+		return err
+	}
+	if err := c.Proven(assignment); err != nil {
+		return err
+	}
+
+	description, err := c.Describe()
+	if err != nil {
+		return err
+	}
+	vk := o.backend.NewVerifyingKey()
+	if err := proofsystem.ReadFrom(o.vk, vk); err != nil {
+		return err
+	}
+	publicWitness, err := witness.Public()
+	if err != nil {
+		return err
+	}
+	b, err := bundle.New(description, vk, publicWitness, proof)
+	if err != nil {
+		return err
+	}
+	if err := b.Write(o.bundle); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "wrote %s and %s\n", o.proof, o.bundle)
+	return nil
+}
+
+// verify checks --proof against --vk and the circuit's public files, or
+// only the --bundle when one is given
+func verify(w io.Writer, o *options) error {
+	if o.set["bundle"] {
+		return verifyBundle(w, o)
+	}
+	c, err := newCircuit(o)
+	if err != nil {
+		return err
+	}
+	public, err := c.Public()
+	if err != nil {
+		return err
+	}
+	publicWitness, err := frontend.NewWitness(public, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		return fmt.Errorf("creating public witness: %w", err)
+	}
+	vk := o.backend.NewVerifyingKey()
+	if err := proofsystem.ReadFrom(o.vk, vk); err != nil {
+		return err
+	}
+	proof := o.backend.NewProof()
+	if err := proofsystem.ReadFrom(o.proof, proof); err != nil {
+		return err
+	}
+	if err := o.backend.Verify(proof, vk, publicWitness); err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	fmt.Fprintln(w, "verification succeeded")
+	return nil
+}
+
+// verifyBundle checks --bundle end to end against --vk, read for the backend
+// the bundle names. The key has to be the verifier's, given with --vk or
+// pinned with --fingerprint.
+func verifyBundle(w io.Writer, o *options) error {
+	if !o.set["vk"] && o.fingerprint == "" {
+		return errors.New("a bundle can't vouch for its own key, give the trusted --vk or pin its --fingerprint")
+	}
+	b, err := bundle.Load(o.bundle)
+	if err != nil {
+		return err
+	}
+	if err := proofsystem.CheckSetup(b.Setup, o.allowUnsafeSRS); err != nil {
+		return err
+	}
+	backend, err := b.ProofSystem()
+	if err != nil {
+		return err
+	}
+	vkPath := o.vk
+	if !o.set["vk"] {
+		vkPath = backend.Files().VK
+	}
+	vk := backend.NewVerifyingKey()
+	if err := proofsystem.ReadFrom(vkPath, vk); err != nil {
+		return err
+	}
+	if o.fingerprint != "" {
+		if err := bundle.CheckPinned(vk, o.fingerprint); err != nil {
+			return err
+		}
+	}
+	if err := b.Verify(vk); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "verification succeeded for the %s circuit %s\n", b.Kind, b.Circuit)
+	if b.Kind == "lipschitz" {
+		publicWitness, err := b.Witness()
+		if err != nil {
+			return err
+		}
+		commitment, bound, err := nn.LipschitzClaim(publicWitness)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "the model with commitment %s has a Lipschitz bound of at most %s\n", commitment, bound)
+	}
+	return nil
+}
+
+// inspect describes every file given with --cs, --vk, --proof, --meta or --bundle
+func inspect(w io.Writer, o *options) error {
+	if !o.set["cs"] && !o.set["vk"] && !o.set["proof"] && !o.set["meta"] && !o.set["bundle"] {
+		return errors.New("nothing to inspect, give --cs, --vk, --proof, --meta or --bundle")
+	}
+	if o.set["cs"] {
+		cs := o.backend.NewCS()
+		if err := proofsystem.ReadFrom(o.cs, cs); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s: ", o.cs)
+		describeCS(w, cs)
+	}
+	if o.set["vk"] {
+		vk := o.backend.NewVerifyingKey()
+		if err := proofsystem.ReadFrom(o.vk, vk); err != nil {
+			return err
+		}
+		fingerprint, err := bundle.Fingerprint(vk)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s: %s verifying key on %s, fingerprint %s\n", o.vk, o.backend.Name(), ecc.BN254, fingerprint)
+	}
+	if o.set["proof"] {
+		proof := o.backend.NewProof()
+		if err := proofsystem.ReadFrom(o.proof, proof); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s: %s proof on %s\n", o.proof, o.backend.Name(), ecc.BN254)
+	}
+	if o.set["meta"] && o.circuit == "lipschitz" {
+		meta, err := nn.LoadLipschitzMetadata(o.meta)
+		if err != nil {
+			return err
+		}
+		s := meta.Shape
+		fmt.Fprintf(w, "%s: circuit %s, layers %v, model commitment %s\n", o.meta, nn.CircuitID("lipschitz", o.backend.Name(), s, meta.Quantization), s.LayerSizes, meta.Commitment)
+		fmt.Fprintf(w, "  the Lipschitz bound is at most %s\n", meta.Bound)
+	} else if o.set["meta"] {
+		meta, err := nn.LoadMetadata(o.meta)
+		if err != nil {
+			return err
+		}
+		if err := meta.Check(); err != nil {
+			return fmt.Errorf("%s: %w", o.meta, err)
+		}
+		s := meta.Shape
+		fmt.Fprintf(w, "%s: circuit %s, %d inputs of %d values, layers %v, model commitment %s\n",
+			o.meta, nn.CircuitID("model", o.backend.Name(), s, meta.Quantization), s.BatchSize, s.InputSize, s.LayerSizes, meta.Commitment)
+		if s.Ball != "" {
+			fmt.Fprintf(w, "  inputs within %s of the center in the %s norm\n", meta.Ball.Radius, s.Ball)
+		}
+		if meta.Label != nil {
+			fmt.Fprintf(w, "  every input and the ball center are classified as %d\n", *meta.Label)
+		}
+		if s.Certify {
+			fmt.Fprintf(w, "  the box of half width %s is certified as %d\n", meta.Certify.Epsilon, meta.Certify.Label)
+		}
+		if meta.Margin != nil {
+			fmt.Fprintf(w, "  every input wins by at least %s\n", meta.Margin)
+		}
+		if meta.SmallestMargin != nil {
+			fmt.Fprintf(w, "  the smallest margin is %s\n", meta.SmallestMargin)
+		}
+	}
+	if o.set["bundle"] {
+		b, err := bundle.Load(o.bundle)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s: %s proof of the %s circuit %s on %s, made %s\n", o.bundle, b.Backend, b.Kind, b.Circuit, b.Curve, b.Created.Format(time.RFC3339))
+		fmt.Fprintf(w, "  for the verifying key with fingerprint %s, %d bytes of public witness and %d of proof\n", b.VKFingerprint, len(b.PublicWitness), len(b.Proof))
+		if b.Setup == proofsystem.UnsafeSetup {
+			fmt.Fprintf(w, "  set up from an unsafe SRS generated for testing\n")
+		}
+		if b.Shape != nil {
+			fmt.Fprintf(w, "  shape %s\n  quantization %s\n", b.Shape, b.Quantization)
+		}
+	}
+	return nil
+}
+
+func describeCS(w io.Writer, cs constraint.ConstraintSystem) {
+	fmt.Fprintf(w, "%d constraints, %d public and %d secret variables\n", cs.GetNbConstraints(), cs.GetNbPublicVariables(), cs.GetNbSecretVariables())
+}
+
+var commands = map[string]func(io.Writer, *options) error{
+	"compile": compile,
+	"setup":   setup,
+	"prove":   prove,
+	"verify":  verify,
+	"inspect": inspect,
+}
+
+// run runs the subcommand named by args[0]
+func run(w io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: zk compile|setup|prove|verify|inspect [flags]")
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, expected compile, setup, prove, verify or inspect", args[0])
+	}
+	o, err := parseOptions(args[0], args[1:])
+	if err != nil {
+		return err
+	}
+	return cmd(w, o)
+}
+
+func main() {
+	if err := run(os.Stdout, os.Args[1:]); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "zk:", err)
+		}
+		os.Exit(1)
+	}
+}
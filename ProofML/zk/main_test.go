@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sudokuChecker/nn"
+
+	"github.com/consensys/gnark/test"
+)
+
+func TestRun(t *testing.T) {
+	assert := test.NewAssert(t)
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	write := func(name, content string) {
+		assert.NoError(os.WriteFile(path(name), []byte(content), 0o644))
+	}
+	write("weights.json", `{
+		"weights": [
+			[[0.1, 0.75, 0.06], [0.77, -0.03, 0.32], [-0.91, 0.91, -0.03]],
+			[[0.1, -0.66, -0.69], [-0.97, 0.49, -0.38], [0.01, 0.21, -0.53]]
+		],
+		"biases": [[-0.13, 0.21, 0.83], [0.34, -0.28, 0.69]]
+	}`)
+	write("outputs.json", `{"outputs": [2]}`)
+	for _, backend := range []string{"groth16", "plonk"} {
+		write("inputs.json", `{"inputs": [[-0.22, 0.03, 0.18]]}`)
+		files := map[string]string{
+			"weights": "weights.json", "inputs": "inputs.json", "outputs": "outputs.json", "meta": "proof.meta.json",
+			"cs": backend + ".cs", "pk": backend + ".pk", "vk": backend + ".vk", "proof": backend + ".proof",
+		}
+		zk := func(args ...string) (string, error) {
+			args = append(args, "--backend", backend, "--allow-unsafe-srs")
+			for flag, file := range files {
+				args = append(args, "--"+flag, path(file))
+			}
+			var out bytes.Buffer
+			err := run(&out, args)
+			return out.String(), err
+		}
+
+		bundle := path(backend + ".bundle.json")
+		for _, cmd := range []string{"compile", "setup", "prove", "verify"} {
+			_, err := zk(cmd, "--report-margin", "--bundle", bundle)
+			assert.NoError(err, backend, cmd)
+		}
+		out, err := zk("inspect", "--bundle", bundle)
+		assert.NoError(err)
+		assert.True(strings.Contains(out, "the smallest margin is 0.152"), out)
+		if backend == "plonk" {
+			// the keys were set up from an unsafe SRS, which the verifier has to allow
+			assert.True(strings.Contains(out, "set up from an unsafe SRS"), out)
+			assert.ErrorContains(run(io.Discard, []string{"verify", "--bundle", bundle, "--vk", path(files["vk"])}), "unsafe SRS")
+			assert.ErrorContains(run(io.Discard, []string{"verify", "--backend", backend, "--vk", path(files["vk"]), "--proof", path(files["proof"]),
+				"--meta", path(files["meta"]), "--inputs", path(files["inputs"])}), "unsafe SRS")
+		}
+		assert.True(strings.Contains(out, backend+" proof of the model circuit"), out)
+
+		// metadata that disagrees with its shape is refused rather than printed
+		meta, err := nn.LoadMetadata(path("proof.meta.json"))
+		assert.NoError(err)
+		meta.SmallestMargin = nil
+		assert.NoError(nn.WriteJSON(path("broken.meta.json"), meta))
+		assert.ErrorContains(run(io.Discard, []string{"inspect", "--meta", path("broken.meta.json")}), "publishes its smallest margin but the metadata has none")
+
+		// the proof says nothing about other inputs
+		write("inputs.json", `{"inputs": [[-0.22, 0.04, 0.18]]}`)
+		_, err = zk("verify")
+		assert.Error(err)
+		// the bundle carries its own public witness, but not a key to trust
+		_, err = zk("verify", "--bundle", bundle)
+		assert.NoError(err)
+		assert.ErrorContains(run(io.Discard, []string{"verify", "--bundle", bundle}), "can't vouch for its own key")
+		_, err = zk("verify", "--bundle", bundle, "--fingerprint", strings.Repeat("0", 64))
+		assert.ErrorContains(err, "is not the pinned key")
+	}
+
+	// the Lipschitz bound of the same model, the largest row sums are 1.85 and 1.84
+	lipschitz := func(args ...string) (string, error) {
+		args = append(args, "--circuit", "lipschitz", "--weights", path("weights.json"), "--cs", path("lipschitz.cs"), "--pk", path("lipschitz.pk"),
+			"--vk", path("lipschitz.vk"), "--proof", path("lipschitz.proof"), "--meta", path("lipschitz.meta.json"))
+		var out bytes.Buffer
+		err := run(&out, args)
+		return out.String(), err
+	}
+	bundle := path("lipschitz.bundle.json")
+	for _, cmd := range []string{"compile", "setup", "prove", "verify"} {
+		_, err := lipschitz(cmd, "--bound", "3.5", "--bundle", bundle)
+		assert.NoError(err, cmd)
+	}
+	out, err := lipschitz("verify", "--bundle", bundle)
+	assert.NoError(err)
+	assert.True(strings.Contains(out, "has a Lipschitz bound of at most 3.5"), out)
+	out, err = lipschitz("inspect")
+	assert.NoError(err)
+	assert.True(strings.Contains(out, "the Lipschitz bound is at most 3.5"), out)
+	_, err = lipschitz("prove", "--bound", "3.4", "--bundle", bundle)
+	assert.Error(err)
+
+	assert.Error(run(io.Discard, []string{"prove", "--circuit", "chess"}))
+	assert.Error(run(io.Discard, []string{"prove", "--backend", "stark"}))
+	assert.Error(run(io.Discard, []string{"frob"}))
+}
+
+func TestRunSudoku(t *testing.T) {
+	if testing.Short() {
+		t.Skip("setting up the Sudoku circuit takes minutes on one core")
+	}
+	assert := test.NewAssert(t)
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	write := func(name, content string) {
+		assert.NoError(os.WriteFile(path(name), []byte(content), 0o644))
+	}
+	// the puzzle and solution of ReadAndWrite/Proof
+	const puzzle = `{"grid":[[5,3,0,0,7,0,0,0,0],[6,0,0,1,9,5,0,0,0],[0,9,8,0,0,0,0,6,0],[8,0,0,0,6,0,0,0,3],[4,0,0,8,0,3,0,0,1],[7,0,0,0,2,0,0,0,6],[0,6,0,0,0,0,2,8,0],[0,0,0,4,1,9,0,0,5],[0,0,0,0,8,0,0,7,9]]}`
+	write("private.json", `{"grid":[[5,3,4,6,7,8,9,1,2],[6,7,2,1,9,5,3,4,8],[1,9,8,3,4,2,5,6,7],[8,5,9,7,6,1,4,2,3],[4,2,6,8,5,3,7,9,1],[7,1,3,9,2,4,8,5,6],[9,6,1,5,3,7,2,8,4],[2,8,7,4,1,9,6,3,5],[3,4,5,2,8,6,1,7,9]]}`)
+	for _, backend := range []string{"groth16", "plonk"} {
+		write("public.json", puzzle)
+		zk := func(args ...string) (string, error) {
+			args = append(args, "--circuit", "sudoku", "--backend", backend, "--allow-unsafe-srs", "--public", path("public.json"), "--private", path("private.json"),
+				"--cs", path(backend+".cs"), "--pk", path(backend+".pk"), "--vk", path(backend+".vk"), "--proof", path(backend+".proof"))
+			var out bytes.Buffer
+			err := run(&out, args)
+			return out.String(), err
+		}
+
+		bundle := path(backend + ".bundle.json")
+		for _, cmd := range []string{"compile", "setup", "prove", "verify"} {
+			_, err := zk(cmd, "--bundle", bundle)
+			assert.NoError(err, backend, cmd)
+		}
+		out, err := zk("inspect", "--bundle", bundle)
+		assert.NoError(err)
+		assert.True(strings.Contains(out, backend+" proof of the sudoku circuit sudoku-9x9-v1"), out)
+		assert.False(strings.Contains(out, "shape"), out)
+
+		// the proof is about this puzzle only, giving one more cell changes the public witness
+		write("public.json", strings.Replace(puzzle, "[5,3,0", "[5,3,4", 1))
+		_, err = zk("verify")
+		assert.Error(err)
+		_, err = zk("verify", "--bundle", bundle)
+		assert.NoError(err)
+	}
+}